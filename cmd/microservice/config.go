@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/auth"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/chaos"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/httpclient"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/ratelimit"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/topology"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/web"
+)
+
+// runConfig handles the config subcommands
+func runConfig(args []string) error {
+	switch {
+	case len(args) >= 1 && args[0] == "validate":
+		return validateConfig(args[1:])
+	case len(args) == 2 && args[0] == "hash-key":
+		fmt.Println(auth.HashKey(args[1]))
+		return nil
+	}
+	return fmt.Errorf("usage: config validate [flags] | config hash-key <key>")
+}
+
+// validateConfig prints the effective configuration and checks it, along
+// with the files it points to
+func validateConfig(args []string) error {
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	loader := configs.NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		printInvalid(unwrapAll(err))
+		return errors.New("configuration is invalid")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE")
+	for _, v := range cfg.Effective() {
+		fmt.Fprintf(w, "%s\t%s\n", v.Key, v.Value)
+	}
+	w.Flush()
+
+	var errs []error
+	if err := cfg.Role.Validate(cfg.ServicoB.URL); err != nil {
+		errs = append(errs, err)
+	}
+	if endpoint := cfg.ServicoB.URL; endpoint != "" {
+		if _, err := httpclient.ParseEndpoints(endpoint); err != nil {
+			errs = append(errs, fmt.Errorf("EXTERNAL_CALL_URL: %w", err))
+		}
+	}
+	if _, err := chaos.LoadConfig(cfg.Middleware.ChaosFile); err != nil {
+		errs = append(errs, fmt.Errorf("CHAOS_CONFIG_FILE: %w", err))
+	}
+	if _, err := ratelimit.LoadConfig(cfg.Middleware.RateLimitFile); err != nil {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_CONFIG_FILE: %w", err))
+	}
+	if _, err := topology.LoadConfig(cfg.Topology.File); err != nil {
+		errs = append(errs, fmt.Errorf("TOPOLOGY_FILE: %w", err))
+	}
+	if cfg.Role.ServesB() {
+		if _, err := weatherAPIKeys(cfg.WeatherAPI); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := authenticator(cfg.Middleware.AuthFile); err != nil {
+		errs = append(errs, fmt.Errorf("AUTH_CONFIG_FILE: %w", err))
+	}
+	if _, err := serverTLSConfig(cfg.Server); err != nil {
+		errs = append(errs, fmt.Errorf("TLS: %w", err))
+	}
+	if err := web.ValidateColor(cfg.Page.BackgroundColor); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		fmt.Fprintln(os.Stderr)
+		printInvalid(errs)
+		return errors.New("configuration is invalid")
+	}
+	fmt.Println("\nconfiguration is valid")
+	return nil
+}
+
+func printInvalid(errs []error) {
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "invalid:", err)
+	}
+}
+
+// unwrapAll splits an errors.Join result into its errors
+func unwrapAll(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, unwrapAll(e)...)
+		}
+		return errs
+	}
+	return []error{err}
+}
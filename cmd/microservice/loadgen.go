@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/auth"
+	"github.com/samucadutra/lab-otel-goexpert/internal/loadgen"
+)
+
+// runLoadgen drives servico-a with a load profile and prints a summary
+func runLoadgen(args []string) error {
+	fs := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	target := fs.String("target", "http://localhost:8080/weather/servico-a", "servico-a endpoint")
+	rps := fs.Float64("rps", 0, "target requests per second (open model)")
+	concurrency := fs.Int("concurrency", 0, "target concurrent requests (closed model)")
+	duration := fs.Duration("duration", 30*time.Second, "duration of a constant load; ignored with -ramp")
+	ramp := fs.String("ramp", "", "ramp-up profile from zero, e.g. 30s@10,1m@50,10s@0; targets are RPS or workers depending on the mode")
+	ceps := fs.String("ceps", "01001000", "comma separated CEPs sent at random")
+	cepFile := fs.String("cep-file", "", "file with one CEP per line, replaces -ceps")
+	timeout := fs.Duration("timeout", 10*time.Second, "per request timeout")
+	slow := fs.Int("slow", 5, "number of slowest requests listed with their trace IDs")
+	apiKey := fs.String("api-key", "", "API key sent in the "+auth.DefaultAPIKeyHeader+" header")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := loadgen.Config{Target: *target, Timeout: *timeout, SlowSize: *slow}
+	if *apiKey != "" {
+		cfg.Header = http.Header{auth.DefaultAPIKeyHeader: {*apiKey}}
+	}
+
+	// with -ramp the stage targets drive the load and -rps or -concurrency
+	// only select the mode, which defaults to rps
+	var level float64
+	switch {
+	case *rps > 0 && *concurrency > 0:
+		return fmt.Errorf("-rps and -concurrency are mutually exclusive")
+	case *concurrency > 0:
+		cfg.Mode, level = loadgen.Concurrency, float64(*concurrency)
+	case *rps > 0:
+		cfg.Mode, level = loadgen.RPS, *rps
+	case *ramp != "":
+		cfg.Mode = loadgen.RPS
+	default:
+		return fmt.Errorf("one of -rps, -concurrency or -ramp is required")
+	}
+
+	if *ramp != "" {
+		profile, err := loadgen.ParseRamp(*ramp)
+		if err != nil {
+			return err
+		}
+		cfg.Profile = profile
+	} else {
+		cfg.Profile = loadgen.Constant(level, *duration)
+	}
+
+	var err error
+	if cfg.CEPs, err = readCEPs(*ceps, *cepFile); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("sending load to %s (%s mode) for %s\n\n", cfg.Target, cfg.Mode, cfg.Profile.Duration())
+	report, err := loadgen.Run(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	report.Print(os.Stdout)
+	return nil
+}
+
+func readCEPs(list, file string) ([]string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CEP file: %w", err)
+		}
+		list = strings.ReplaceAll(string(data), "\n", ",")
+	}
+
+	ceps := splitList(list)
+	if len(ceps) == 0 {
+		return nil, fmt.Errorf("no CEPs to send")
+	}
+	return ceps, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+	"github.com/samucadutra/lab-otel-goexpert/internal/usecase/servico_b_usecase"
+)
+
+// runLookup runs the servico-b pipeline in process for a single CEP
+func runLookup(args []string) error {
+	fs := flag.NewFlagSet("lookup", flag.ContinueOnError)
+	format := fs.String("format", "table", "output format: table or json")
+	loader := configs.NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: lookup [-format table|json] <cep>")
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("invalid format %q: must be table or json", *format)
+	}
+
+	cfg, err := loadConfig(loader)
+	if err != nil {
+		return err
+	}
+	zipcode := fs.Arg(0)
+	keys, err := weatherAPIKeys(cfg.WeatherAPI)
+	if err != nil {
+		return err
+	}
+	uc := servico_b_usecase.NewServicoBUseCase(keys, nil)
+	output, err := uc.Execute(context.Background(), zipcode)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(output)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CEP\tCITY\tUF\tTEMP_C\tTEMP_F\tTEMP_K")
+	fmt.Fprintf(w, "%s\t%s\t%s\t%.1f\t%.1f\t%.2f\n", zipcode, output.City, output.UF, output.TempC, output.TempF, output.TempK)
+	return w.Flush()
+}
@@ -1,126 +1,87 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"os/signal"
-	"time"
+	"strings"
 
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/redact"
 	"github.com/samucadutra/lab-otel-goexpert/internal/infra/web"
-	"github.com/spf13/viper"
-
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/zipkin"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
-func initProvider(serviceName, collectorURL string) (func(context.Context) error, error) {
-	ctx := context.Background()
-
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName(serviceName),
-		))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+}
 
-	traceExporter, err := zipkin.New("http://zipkin:9411/api/v2/spans")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+// run dispatches to the subcommand in args, serving when none is given
+func run(args []string) error {
+	log.SetOutput(redact.Writer(os.Stderr))
+	if len(args) == 0 {
+		return runServe(nil)
 	}
 
-	bsp := sdktrace.NewBatchSpanProcessor(traceExporter)
-	traceProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithResource(res),
-		sdktrace.WithSpanProcessor(bsp),
-	)
-	otel.SetTracerProvider(traceProvider)
-
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-
-	return traceProvider.Shutdown, nil
+	switch args[0] {
+	case "serve":
+		return runServe(args[1:])
+	case "lookup":
+		return runLookup(args[1:])
+	case "loadgen":
+		return runLoadgen(args[1:])
+	case "replay":
+		return runReplay(args[1:])
+	case "config":
+		return runConfig(args[1:])
+	case "help", "-h", "-help", "--help":
+		usage(os.Stdout)
+		return nil
+	}
+	usage(os.Stderr)
+	return fmt.Errorf("unknown command %q", args[0])
 }
 
-func init() {
-	viper.AutomaticEnv()
-	viper.SetDefault("WEB_SERVER_PORT", ":8080")
-	viper.SetDefault("WEATHER_API_KEY", "3e911140d0214dd8bb622421250705")
+func usage(w *os.File) {
+	fmt.Fprint(w, `Usage: ms <command> [arguments]
+
+Commands:
+  serve [flags]                   start the HTTP server (default); -h lists the setting flags
+  lookup [-format table|json] CEP run the servico-b pipeline locally for a CEP
+  loadgen [flags]                 send load to servico-a and report latencies and errors
+  replay [flags] FILE             re-send a recording and report the responses that changed
+  config validate [flags]         check the configuration and print the effective values
+  config hash-key <key>           print the hash to store for an API key in AUTH_CONFIG_FILE
+`)
 }
 
-//func main() {
-//	//config, err := configs.LoadConfig(".")
-//	//if err != nil {
-//	//	panic(err)
-//	//}
-//
-//	weatherApiKey := viper.GetString("WEATHER_API_KEY")
-//	webServerPort := viper.GetString("WEB_SERVER_PORT")
-//
-//	weatherHandler := handlers.NewWeatherHandler(weatherApiKey)
-//	webserver := webserver.NewWebServer(webServerPort)
-//	webserver.Router.Use(middleware.Logger)
-//	webserver.Router.Route("/weather", func(r chi.Router) {
-//		r.Post("/current", weatherHandler.ProcessServicoA)
-//		r.Get("/process/{zipcode}", weatherHandler.ProcessServicoB)
-//	})
-//
-//	webserver.Start()
-//}
-
-func main() {
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt)
-
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer cancel()
-
-	shutdown, err := initProvider(viper.GetString("OTEL_SERVICE_NAME"), viper.GetString("OTEL_EXPORTER_OTLP_ENDPOINT"))
+// loadConfig loads and validates the configuration, then masks its
+// REDACT_* query parameters and headers, on top of the defaults, in errors,
+// logs and spans
+func loadConfig(loader *configs.Loader) (*configs.Config, error) {
+	cfg, err := loader.Load()
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
 	}
-	defer func() {
-		if err := shutdown(ctx); err != nil {
-			log.Fatal("failed to shutdown TracerProvider: %w", err)
-		}
-	}()
-
-	tracer := otel.Tracer(viper.GetString("OTEL_SERVICE_NAME"))
-
-	templateData := &web.TemplateData{
-		Title:              viper.GetString("TITLE"),
-		BackgroundColor:    viper.GetString("BACKGROUND_COLOR"),
-		ResponseTime:       time.Duration(viper.GetInt("RESPONSE_TIME")),
-		ExternalCallURL:    viper.GetString("EXTERNAL_CALL_URL"),
-		ExternalCallMethod: viper.GetString("EXTERNAL_CALL_METHOD"),
-		RequestNameOTEL:    viper.GetString("REQUEST_NAME_OTEL"),
-		OTELTracer:         tracer,
+	if err := web.ValidateColor(cfg.Page.BackgroundColor); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
 	}
-	server := web.NewServer(templateData)
-	router := server.CreateServer()
+	redact.SetDefault(redact.New(redact.Config{
+		QueryParams: cfg.Redact.QueryParams,
+		Headers:     cfg.Redact.Headers,
+	}))
+	return cfg, nil
+}
 
-	go func() {
-		log.Println("Starting server on port", viper.GetString("WEB_SERVER_PORT"))
-		if err := http.ListenAndServe(viper.GetString("WEB_SERVER_PORT"), router); err != nil {
-			log.Fatal(err)
+// splitList splits a comma separated flag or setting, dropping empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
-	}()
-
-	select {
-	case <-sigCh:
-		log.Println("Shutting down gracefully, CTRL+C pressed...")
-	case <-ctx.Done():
-		log.Println("Shutting down due to other reason...")
 	}
-
-	// Create a timeout context for the graceful shutdown
-	_, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer shutdownCancel()
+	return items
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/chaos"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/ratelimit"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/sampling"
+)
+
+// reloader applies the reloadable settings of a new configuration to the
+// running components: the trace sampling ratio, the injected latencies and
+// the rate limits. Other changes are logged and wait for a restart.
+type reloader struct {
+	loader *configs.Loader
+	// startup is the configuration the process started with, which settings
+	// that need a restart still come from
+	startup     *configs.Config
+	current     atomic.Pointer[configs.Config]
+	sampler     *sampling.Sampler
+	chaos       *chaos.Injector
+	rateLimiter *ratelimit.Limiter
+}
+
+// files are the files whose changes trigger a reload
+func (r *reloader) files() []string {
+	current := r.current.Load()
+	return []string{r.loader.File(), current.Middleware.ChaosFile, current.Middleware.RateLimitFile}
+}
+
+// applied returns the settings in use, which are the startup ones for the
+// settings that wait for a restart
+func (r *reloader) applied() []configs.EffectiveValue {
+	return r.current.Load().Applied(r.startup)
+}
+
+// reload loads the configuration again, keeping the current one when any
+// part of the new one is invalid
+func (r *reloader) reload() {
+	cfg, err := r.loader.Load()
+	if err != nil {
+		log.Printf("Config reload failed, keeping the current configuration: %v", err)
+		return
+	}
+	chaosConfig, err := loadChaosConfig(cfg)
+	if err != nil {
+		log.Printf("Config reload failed, keeping the current configuration: %v", err)
+		return
+	}
+	rateLimitConfig, err := ratelimit.LoadConfig(cfg.Middleware.RateLimitFile)
+	if err != nil {
+		log.Printf("Config reload failed, keeping the current configuration: %v", err)
+		return
+	}
+
+	r.sampler.SetRatio(cfg.Tracing.SampleRatio)
+	r.chaos.Update(chaosConfig)
+	r.rateLimiter.Update(rateLimitConfig)
+	if changed := cfg.Changed(r.startup); len(changed) > 0 {
+		log.Printf("Config reloaded; restart to apply %s", strings.Join(changed, ", "))
+	} else {
+		log.Println("Config reloaded")
+	}
+	r.current.Store(cfg)
+}
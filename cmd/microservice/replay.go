@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/recording"
+)
+
+// runReplay re-sends a recording and prints the responses that differ
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	target := fs.String("target", "http://localhost:8080", "base URL the recorded paths are sent to")
+	speed := fs.Float64("speed", 1, "pace multiplier: 1 keeps the recorded timing, 2 is twice as fast, 0 sends back to back")
+	ignore := fs.String("ignore", "", "comma separated JSON response fields left out of the comparison, e.g. temp_C,temp_F,temp_K")
+	timeout := fs.Duration("timeout", 10*time.Second, "per request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: replay [-target URL] [-speed N] [-ignore fields] <recording.jsonl>")
+	}
+	if *speed < 0 {
+		return fmt.Errorf("-speed must not be negative")
+	}
+
+	entries, err := recording.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("recording %s is empty", fs.Arg(0))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("replaying %d requests against %s\n\n", len(entries), *target)
+	outcomes := recording.Replay(ctx, entries, recording.ReplayConfig{
+		Target:       *target,
+		Speed:        *speed,
+		IgnoreFields: splitList(*ignore),
+		Client:       &http.Client{Timeout: *timeout},
+	})
+
+	matched, changed, failed := 0, 0, 0
+	for _, o := range outcomes {
+		switch {
+		case o.Err != nil:
+			failed++
+			fmt.Printf("%s %s [trace %s]: %v\n", o.Entry.Method, o.Entry.Path, o.Entry.TraceID, o.Err)
+		case len(o.Diffs) > 0:
+			changed++
+			fmt.Printf("%s %s [trace %s]:\n", o.Entry.Method, o.Entry.Path, o.Entry.TraceID)
+			for _, diff := range o.Diffs {
+				fmt.Printf("  %s\n", diff)
+			}
+		default:
+			matched++
+		}
+	}
+	fmt.Printf("\nmatched: %d  changed: %d  failed: %d\n", matched, changed, failed)
+	return nil
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/auth"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/chaos"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/health"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/httpclient"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/keypool"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/quota"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/ratelimit"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/recording"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/redact"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/sampling"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/tlsconfig"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/topology"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/web"
+	"github.com/samucadutra/lab-otel-goexpert/internal/usecase/servico_a_usecase"
+	"github.com/samucadutra/lab-otel-goexpert/internal/usecase/servico_b_usecase"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+func initProvider(cfg configs.Tracing) (func(context.Context) error, *sampling.Sampler, error) {
+	ctx := context.Background()
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName(cfg.ServiceName),
+		))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	traceExporter, err := zipkin.New(cfg.ZipkinEndpoint)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	sampler := sampling.New(cfg.SampleRatio)
+	bsp := sdktrace.NewBatchSpanProcessor(redact.Exporter(traceExporter))
+	traceProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(bsp),
+	)
+	otel.SetTracerProvider(traceProvider)
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return traceProvider.Shutdown, sampler, nil
+}
+
+// runServe starts the HTTP server with the routes of SERVICE_ROLE
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	loader := configs.NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(loader)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Role.Validate(cfg.ServicoB.URL); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	// SIGTERM is what Docker and Kubernetes send on stop
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// a second signal terminates the process right away
+	context.AfterFunc(ctx, cancel)
+
+	role := cfg.Role
+	log.Println("Starting with SERVICE_ROLE", role)
+
+	shutdown, sampler, err := initProvider(cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	server := web.NewServer(cfg.Server.Port)
+	server.ReadinessDelay = cfg.Server.ShutdownReadinessDelay
+	server.GracePeriod = cfg.Server.ShutdownGracePeriod
+	// appended first so it stops last, flushing the spans of the requests
+	// drained during shutdown
+	server.Append(web.Hook{Name: "tracing", OnStop: func(ctx context.Context) error {
+		return shutdown(ctx)
+	}})
+	if server.TLSConfig, err = serverTLSConfig(cfg.Server); err != nil {
+		return err
+	}
+
+	tracer := otel.Tracer(cfg.Tracing.ServiceName)
+
+	templateData := &web.TemplateData{
+		Title:              cfg.Page.Title,
+		BackgroundColor:    cfg.Page.BackgroundColor,
+		ExternalCallURL:    cfg.Page.ExternalCallURL,
+		ExternalCallMethod: cfg.Page.ExternalCallMethod,
+		LookupURL:          lookupURL(cfg),
+		TracingUIURL:       cfg.Tracing.UIURL,
+		RequestNameOTEL:    cfg.Tracing.SpanName,
+		OTELTracer:         tracer,
+	}
+	chaosConfig, err := loadChaosConfig(cfg)
+	if err != nil {
+		return err
+	}
+	rateLimitConfig, err := ratelimit.LoadConfig(cfg.Middleware.RateLimitFile)
+	if err != nil {
+		return err
+	}
+	injector := chaos.NewInjector(chaosConfig)
+	rateLimiter := ratelimit.NewLimiter(rateLimitConfig)
+	authn, err := authenticator(cfg.Middleware.AuthFile)
+	if err != nil {
+		return err
+	}
+	topo, err := topologyHandler(cfg)
+	if err != nil {
+		return err
+	}
+
+	var keys *keypool.Pool
+	var weatherAPIQuota *quota.Limiter
+	if role.ServesB() {
+		if keys, err = weatherAPIKeys(cfg.WeatherAPI); err != nil {
+			return err
+		}
+		log.Printf("Using %d WeatherAPI key(s): %s", keys.Len(), strings.Join(keys.Fingerprints(), ", "))
+		if weatherAPIQuota, err = servico_b_usecase.NewWeatherAPIQuota(cfg.WeatherAPI); err != nil {
+			return err
+		}
+		server.Append(web.Hook{
+			Name: "weatherapi-quota",
+			OnStop: func(context.Context) error {
+				return weatherAPIQuota.Close()
+			},
+		})
+	}
+	var servicoB *httpclient.Client
+	if role.ServesA() && cfg.ServicoB.URL != "" {
+		if servicoB, err = servico_a_usecase.NewServicoBClient(cfg.ServicoB); err != nil {
+			return err
+		}
+		server.Append(web.Hook{
+			Name: "servico-b-client",
+			OnStart: func(ctx context.Context) error {
+				if err := servicoB.Start(ctx); err != nil {
+					return fmt.Errorf("failed to resolve servico-b instances: %w", err)
+				}
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				servicoB.Close()
+				return nil
+			},
+		})
+	}
+
+	app := server.Group()
+	if path := cfg.Record.File; path != "" {
+		recorder, err := recording.NewRecorder(path, cfg.Record.Headers)
+		if err != nil {
+			return err
+		}
+		server.Append(web.Hook{Name: "recorder", OnStop: func(context.Context) error {
+			return recorder.Close()
+		}})
+		app.Use(recorder.Middleware)
+		log.Println("Recording requests to", path)
+	}
+	// authentication runs first so the rate limiter keys on the verified
+	// principal and rejected requests do not spend anyone's tokens
+	app.UseRoute(authn.Route, rateLimiter.Route, injector.Route)
+	app.Mount(web.Weather{
+		Role:            role,
+		Tracer:          tracer,
+		SpanName:        cfg.Tracing.SpanName,
+		ServicoB:        servicoB,
+		WeatherAPIKeys:  keys,
+		WeatherAPIQuota: weatherAPIQuota,
+	})
+	if role.ServesDemo() {
+		if templateData.LookupClient, err = lookupClient(cfg); err != nil {
+			return err
+		}
+		if key := cfg.Page.LookupAPIKey; key != "" {
+			templateData.LookupHeader = http.Header{auth.DefaultAPIKeyHeader: {key}}
+		}
+		app.Mount(web.NewPage(templateData))
+	}
+	app.Mount(web.Topology{Handler: topo})
+
+	reloader := &reloader{loader: loader, startup: cfg, sampler: sampler, chaos: injector, rateLimiter: rateLimiter}
+	reloader.current.Store(cfg)
+
+	// the metrics, readiness and debug pages stay off the public port unless
+	// ADMIN_PORT is empty; only the liveness probe is kept there
+	admin := server
+	if cfg.Server.AdminPort != "" {
+		admin = web.NewServer(cfg.Server.AdminPort)
+		admin.Readiness = server.Readiness
+		server.Append(admin.Serve("admin server"))
+		server.Group().Mount(web.Liveness{})
+	}
+	admin.Group().UseRoute(authn.Route).Mount(
+		web.Admin{Readiness: server.Readiness},
+		web.Debug{Values: reloader.applied},
+	)
+	registerHealthChecks(server.Readiness, cfg, servicoB)
+
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	server.Append(web.Hook{
+		Name: "config-watch",
+		OnStart: func(context.Context) error {
+			hangup := make(chan os.Signal, 1)
+			signal.Notify(hangup, syscall.SIGHUP)
+			go func() {
+				defer signal.Stop(hangup)
+				configs.Watch(watchCtx, cfg.ReloadInterval, hangup, reloader.files, reloader.reload)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			stopWatch()
+			return nil
+		},
+	})
+	defer stopWatch()
+
+	return server.Run(ctx)
+}
+
+// loadChaosConfig reads CHAOS_CONFIG_FILE, adding the RESPONSE_TIME latency
+// on the index page
+func loadChaosConfig(cfg *configs.Config) (chaos.Config, error) {
+	chaosConfig, err := chaos.LoadConfig(cfg.Middleware.ChaosFile)
+	if err != nil {
+		return chaos.Config{}, err
+	}
+	// RESPONSE_TIME is kept as a shorthand for a fixed latency on the index page
+	if responseTime := cfg.Page.ResponseTime; responseTime > 0 {
+		if _, ok := chaosConfig.Routes[web.RouteIndex]; !ok {
+			if chaosConfig.Routes == nil {
+				chaosConfig.Routes = make(map[string]chaos.Rule)
+			}
+			chaosConfig.Routes[web.RouteIndex] = chaos.Rule{Latency: &chaos.Latency{
+				Distribution: chaos.Fixed,
+				Value:        responseTime,
+			}}
+		}
+	}
+	return chaosConfig, nil
+}
+
+// weatherAPIKeys builds the WeatherAPI key pool from WEATHER_API_KEY,
+// WEATHER_API_KEYS and the secret file WEATHER_API_KEYS_FILE
+func weatherAPIKeys(cfg configs.WeatherAPI) (*keypool.Pool, error) {
+	values := append([]string{cfg.Key}, cfg.Keys...)
+	if path := cfg.KeysFile; path != "" {
+		fromFile, err := keypool.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, fromFile...)
+	}
+	keys := keypool.New("weatherapi", values, cfg.KeyCooldown)
+	if keys.Len() == 0 {
+		return nil, errors.New("a WeatherAPI key is required: set WEATHER_API_KEY, WEATHER_API_KEYS or WEATHER_API_KEYS_FILE")
+	}
+	return keys, nil
+}
+
+// authenticator enforces the policies of AUTH_CONFIG_FILE, nil when unset
+func authenticator(path string) (*auth.Authenticator, error) {
+	cfg, err := auth.LoadConfig(path)
+	if err != nil || cfg.Routes == nil {
+		return nil, err
+	}
+	return auth.NewAuthenticator(cfg)
+}
+
+// serverTLSConfig returns the listener TLS configuration, nil for plain HTTP
+func serverTLSConfig(cfg configs.Server) (*tls.Config, error) {
+	return tlsconfig.Server(tlsconfig.ServerOptions{
+		CertFile:       cfg.TLSCertFile,
+		KeyFile:        cfg.TLSKeyFile,
+		ClientCAFiles:  cfg.TLSClientCAFile,
+		ClientAuth:     cfg.TLSClientAuth,
+		ReloadInterval: cfg.TLSReloadInterval,
+	})
+}
+
+// registerHealthChecks adds the dependency checks of role to readiness,
+// probing servico-b through servicoB when set
+func registerHealthChecks(readiness *health.Readiness, cfg *configs.Config, servicoB *httpclient.Client) {
+	role := cfg.Role
+	timeout := cfg.Health.CheckTimeout
+	ttl := cfg.Health.CacheTTL
+
+	if servicoB != nil {
+		ping := func(ctx context.Context) error {
+			return servico_a_usecase.PingServicoB(ctx, servicoB, cfg.ServicoB.HealthCheckPath)
+		}
+		readiness.AddCheck(health.Check{Name: "servico-b", Run: ping, Timeout: timeout, CacheTTL: ttl})
+	}
+	if role.ServesB() {
+		// third-party APIs are probed less often
+		externalTTL := cfg.Health.ExternalCacheTTL
+		readiness.AddCheck(health.Check{Name: "viacep", Run: servico_b_usecase.PingViaCEP, Timeout: timeout, CacheTTL: externalTTL})
+		readiness.AddCheck(health.Check{Name: "weatherapi", Run: servico_b_usecase.PingWeatherAPI, Timeout: timeout, CacheTTL: externalTTL})
+	}
+	if u, err := url.Parse(cfg.Tracing.ZipkinEndpoint); err == nil {
+		// losing spans must not take the service out of rotation
+		readiness.AddCheck(health.Check{Name: "trace-exporter", Run: health.TCP(u.Host), Timeout: timeout, CacheTTL: ttl, Optional: true})
+	}
+}
+
+// lookupURL is the servico-a endpoint used by the CEP form, defaulting to this
+// process when it serves servico-a itself
+func lookupURL(cfg *configs.Config) string {
+	if url := cfg.Page.LookupURL; url != "" {
+		return url
+	}
+	port := cfg.Server.Port
+	if cfg.Role.ServesA() && strings.HasPrefix(port, ":") {
+		scheme := "http"
+		if cfg.Server.TLSCertFile != "" {
+			scheme = "https"
+		}
+		return scheme + "://localhost" + port + "/weather/servico-a"
+	}
+	return ""
+}
+
+// lookupClient is the client of the CEP form. It trusts the CA and presents
+// the client certificate of the servico-b client, and also trusts the
+// certificate of this server when the form calls it, so lookups work
+// against a servico-a with TLS or mTLS.
+func lookupClient(cfg *configs.Config) (*http.Client, error) {
+	caFiles := cfg.ServicoB.CAFile
+	if cfg.Page.LookupURL == "" && cfg.Server.TLSCertFile != "" {
+		caFiles = strings.Trim(caFiles+","+cfg.Server.TLSCertFile, ",")
+	}
+	tlsConfig, err := tlsconfig.Client(tlsconfig.ClientOptions{
+		CAFiles:        caFiles,
+		CertFile:       cfg.ServicoB.ClientCertFile,
+		KeyFile:        cfg.ServicoB.ClientKeyFile,
+		ReloadInterval: cfg.ServicoB.TLSReloadInterval,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid lookup TLS settings: %w", err)
+	}
+	if tlsConfig == nil {
+		return http.DefaultClient, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// topologyHandler returns the handler of this instance in TOPOLOGY_FILE, found
+// by TOPOLOGY_SERVICE or else OTEL_SERVICE_NAME, or nil without a topology
+func topologyHandler(cfg *configs.Config) (*topology.Handler, error) {
+	topo, err := topology.LoadConfig(cfg.Topology.File)
+	if err != nil || len(topo.Services) == 0 {
+		return nil, err
+	}
+
+	name := cfg.Topology.Service
+	if name == "" {
+		name = cfg.Tracing.ServiceName
+	}
+	service, ok := topo.Services[name]
+	if !ok {
+		return nil, fmt.Errorf("service %q not found in %s", name, cfg.Topology.File)
+	}
+	log.Printf("Simulating topology service %s with %d calls (%s)", name, len(service.Calls), service.Mode)
+	return topology.NewHandler(name, service), nil
+}
@@ -1,26 +1,441 @@
 package configs
 
-import "github.com/spf13/viper"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
 
-type conf struct {
-	WebServerPort string `mapstructure:"WEB_SERVER_PORT"`
-	WeatherApiKey string `mapstructure:"WEATHER_API_KEY"`
+	"github.com/spf13/viper"
+)
+
+// Config is the typed configuration of the binary, loaded and validated once
+// at startup and handed to the components that need it
+type Config struct {
+	Role       Role
+	Server     Server
+	Health     Health
+	Tracing    Tracing
+	Page       Page
+	WeatherAPI WeatherAPI
+	ServicoB   ServicoB
+	Middleware Middleware
+	Topology   Topology
+	Record     Record
+	Redact     Redact
+	// ReloadInterval is how often the watched files are checked for changes
+	ReloadInterval time.Duration
+
+	// values are the raw settings, kept for Effective and Changed
+	values map[string]string
+}
+
+// Server configures the listener and its shutdown
+type Server struct {
+	Port string
+	// AdminPort is the address of the admin listener; empty serves the admin
+	// routes on Port
+	AdminPort              string
+	TLSCertFile            string
+	TLSKeyFile             string
+	TLSClientCAFile        string
+	TLSClientAuth          string
+	TLSReloadInterval      time.Duration
+	ShutdownGracePeriod    time.Duration
+	ShutdownReadinessDelay time.Duration
+}
+
+// Health configures the readiness checks
+type Health struct {
+	CheckTimeout     time.Duration
+	CacheTTL         time.Duration
+	ExternalCacheTTL time.Duration
+}
+
+// Tracing configures the spans of the process
+type Tracing struct {
+	ServiceName string
+	// ZipkinEndpoint is the URL the spans are exported to
+	ZipkinEndpoint string
+	// SpanName names the server spans of the weather routes
+	SpanName string
+	// SampleRatio is the share of new traces recorded, from 0 to 1
+	SampleRatio float64
+	UIURL       string
+}
+
+// Page configures the index page of the demo role
+type Page struct {
+	Title              string
+	BackgroundColor    string
+	LookupURL          string
+	ExternalCallURL    string
+	ExternalCallMethod string
+	// LookupAPIKey is sent by the CEP form to servico-a
+	LookupAPIKey string
+	// ResponseTime is a fixed latency injected on the index page
+	ResponseTime time.Duration
+}
+
+// WeatherAPI configures the keys and limits of the WeatherAPI calls
+type WeatherAPI struct {
+	Key           string
+	Keys          []string
+	KeysFile      string
+	KeyCooldown   time.Duration
+	RPS           float64
+	Burst         int
+	MonthlyBudget int64
+	QuotaFile     string
+}
+
+// ServicoB configures the servico-a client of servico-b
+type ServicoB struct {
+	// URL is EXTERNAL_CALL_URL, one or more servico-b endpoints
+	URL                 string
+	APIKey              string
+	AttemptTimeout      time.Duration
+	MaxAttempts         int
+	BackoffBase         time.Duration
+	BackoffMax          time.Duration
+	BreakerThreshold    int
+	BreakerCooldown     time.Duration
+	LBPolicy            string
+	ResolveInterval     time.Duration
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	HedgePercentile     float64
+	HedgeMinDelay       time.Duration
+	HedgeMaxDelay       time.Duration
+	CAFile              string
+	ClientCertFile      string
+	ClientKeyFile       string
+	ServerName          string
+	TLSReloadInterval   time.Duration
+}
+
+// Middleware points to the YAML files of the per-route middlewares
+type Middleware struct {
+	ChaosFile     string
+	RateLimitFile string
+	AuthFile      string
+}
+
+// Topology selects the simulated service of this instance
+type Topology struct {
+	File    string
+	Service string
+}
+
+// Record configures the request recording
+type Record struct {
+	File    string
+	Headers []string
 }
 
-func LoadConfig(path string) (*conf, error) {
-	var cfg *conf
-	viper.SetConfigName("app_config")
-	viper.SetConfigType("env")
-	viper.AddConfigPath(path)
-	viper.SetConfigFile(".env")
-	viper.AutomaticEnv()
-	err := viper.ReadInConfig()
+// Redact lists the sensitive names masked on top of the defaults
+type Redact struct {
+	QueryParams []string
+	Headers     []string
+}
+
+// Loader reads the configuration from, by increasing precedence, the setting
+// defaults, a YAML file, the environment and the command line flags. It can
+// be called again to reload the configuration.
+type Loader struct {
+	fs    *flag.FlagSet
+	file  *string
+	flags map[string]string
+}
+
+// NewLoader registers on fs a -config flag with the YAML file, defaulting to
+// CONFIG_FILE, and a flag per setting named after its key in lower case with
+// dashes, e.g. -web-server-port for WEB_SERVER_PORT
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{fs: fs, flags: make(map[string]string)}
+	l.file = fs.String("config", "", "YAML `file` with the settings, defaults to CONFIG_FILE")
+	for _, s := range Settings {
+		name := FlagName(s.Key)
+		l.flags[name] = s.Key
+		fs.String(name, "", "sets "+s.Key)
+	}
+	return l
+}
+
+// FlagName is the command line flag of a setting key
+func FlagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// File returns the YAML file the configuration is read from, if any
+func (l *Loader) File() string {
+	if *l.file != "" {
+		return *l.file
+	}
+	return os.Getenv("CONFIG_FILE")
+}
+
+// Load reads and validates the configuration, reporting every invalid
+// setting at once
+func (l *Loader) Load() (*Config, error) {
+	v := viper.New()
+	for _, s := range Settings {
+		if s.Default != nil {
+			v.SetDefault(s.Key, s.Default)
+		}
+	}
+	v.AutomaticEnv()
+
+	var errs []error
+	if file := l.File(); file != "" {
+		v.SetConfigFile(file)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		for _, key := range v.AllKeys() {
+			if !isSetting(key) {
+				errs = append(errs, fmt.Errorf("%s: unknown setting %q", file, key))
+			}
+		}
+	}
+	l.fs.Visit(func(f *flag.Flag) {
+		if key, ok := l.flags[f.Name]; ok {
+			v.Set(key, f.Value.String())
+		}
+	})
+
+	values := make(map[string]string, len(Settings))
+	for _, s := range Settings {
+		values[s.Key] = v.GetString(s.Key)
+	}
+	cfg, err := newConfig(values)
 	if err != nil {
-		panic(err)
+		errs = append(errs, err)
 	}
-	err = viper.Unmarshal(&cfg)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Default returns the configuration made of the setting defaults alone
+func Default() *Config {
+	values := make(map[string]string, len(Settings))
+	for _, s := range Settings {
+		if s.Default != nil {
+			values[s.Key] = fmt.Sprint(s.Default)
+		}
+	}
+	cfg, err := newConfig(values)
 	if err != nil {
 		panic(err)
 	}
-	return cfg, err
+	return cfg
+}
+
+func isSetting(key string) bool {
+	return slices.ContainsFunc(Settings, func(s Setting) bool { return strings.EqualFold(s.Key, key) })
+}
+
+// newConfig parses and validates values
+func newConfig(values map[string]string) (*Config, error) {
+	var errs []error
+	for _, s := range Settings {
+		if err := s.validate(values[s.Key]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		// the typed values below would hide the parse errors
+		return nil, errors.Join(errs...)
+	}
+
+	p := parser{values}
+	cfg := &Config{
+		Server: Server{
+			Port:                   p.string("WEB_SERVER_PORT"),
+			AdminPort:              p.string("ADMIN_PORT"),
+			TLSCertFile:            p.string("TLS_CERT_FILE"),
+			TLSKeyFile:             p.string("TLS_KEY_FILE"),
+			TLSClientCAFile:        p.string("TLS_CLIENT_CA_FILE"),
+			TLSClientAuth:          p.string("TLS_CLIENT_AUTH"),
+			TLSReloadInterval:      p.duration("TLS_RELOAD_INTERVAL"),
+			ShutdownGracePeriod:    p.duration("SHUTDOWN_GRACE_PERIOD"),
+			ShutdownReadinessDelay: p.duration("SHUTDOWN_READINESS_DELAY"),
+		},
+		Health: Health{
+			CheckTimeout:     p.duration("HEALTH_CHECK_TIMEOUT"),
+			CacheTTL:         p.duration("HEALTH_CACHE_TTL"),
+			ExternalCacheTTL: p.duration("HEALTH_EXTERNAL_CACHE_TTL"),
+		},
+		Tracing: Tracing{
+			ServiceName:    p.string("OTEL_SERVICE_NAME"),
+			ZipkinEndpoint: p.string("ZIPKIN_ENDPOINT"),
+			SpanName:       p.string("REQUEST_NAME_OTEL"),
+			SampleRatio:    p.float("TRACE_SAMPLE_RATIO"),
+			UIURL:          p.string("TRACING_UI_URL"),
+		},
+		Page: Page{
+			Title:              p.string("TITLE"),
+			BackgroundColor:    p.string("BACKGROUND_COLOR"),
+			LookupURL:          p.string("LOOKUP_URL"),
+			LookupAPIKey:       p.string("LOOKUP_API_KEY"),
+			ExternalCallURL:    p.string("PAGE_EXTERNAL_CALL_URL"),
+			ExternalCallMethod: p.string("EXTERNAL_CALL_METHOD"),
+			ResponseTime:       time.Duration(p.int("RESPONSE_TIME")) * time.Millisecond,
+		},
+		WeatherAPI: WeatherAPI{
+			Key:           p.string("WEATHER_API_KEY"),
+			Keys:          p.list("WEATHER_API_KEYS"),
+			KeysFile:      p.string("WEATHER_API_KEYS_FILE"),
+			KeyCooldown:   p.duration("WEATHER_API_KEY_COOLDOWN"),
+			RPS:           p.float("WEATHER_API_RPS"),
+			Burst:         p.int("WEATHER_API_BURST"),
+			MonthlyBudget: int64(p.int("WEATHER_API_MONTHLY_BUDGET")),
+			QuotaFile:     p.string("WEATHER_API_QUOTA_FILE"),
+		},
+		ServicoB: ServicoB{
+			URL:                 p.string("EXTERNAL_CALL_URL"),
+			APIKey:              p.string("SERVICO_B_API_KEY"),
+			AttemptTimeout:      p.duration("SERVICO_B_ATTEMPT_TIMEOUT"),
+			MaxAttempts:         p.int("SERVICO_B_MAX_ATTEMPTS"),
+			BackoffBase:         p.duration("SERVICO_B_BACKOFF_BASE"),
+			BackoffMax:          p.duration("SERVICO_B_BACKOFF_MAX"),
+			BreakerThreshold:    p.int("SERVICO_B_BREAKER_THRESHOLD"),
+			BreakerCooldown:     p.duration("SERVICO_B_BREAKER_COOLDOWN"),
+			LBPolicy:            p.string("SERVICO_B_LB_POLICY"),
+			ResolveInterval:     p.duration("SERVICO_B_RESOLVE_INTERVAL"),
+			HealthCheckPath:     p.string("SERVICO_B_HEALTH_CHECK_PATH"),
+			HealthCheckInterval: p.duration("SERVICO_B_HEALTH_CHECK_INTERVAL"),
+			HealthCheckTimeout:  p.duration("SERVICO_B_HEALTH_CHECK_TIMEOUT"),
+			HedgePercentile:     p.float("SERVICO_B_HEDGE_PERCENTILE"),
+			HedgeMinDelay:       p.duration("SERVICO_B_HEDGE_MIN_DELAY"),
+			HedgeMaxDelay:       p.duration("SERVICO_B_HEDGE_MAX_DELAY"),
+			CAFile:              p.string("SERVICO_B_CA_FILE"),
+			ClientCertFile:      p.string("SERVICO_B_CLIENT_CERT_FILE"),
+			ClientKeyFile:       p.string("SERVICO_B_CLIENT_KEY_FILE"),
+			ServerName:          p.string("SERVICO_B_SERVER_NAME"),
+			TLSReloadInterval:   p.duration("TLS_RELOAD_INTERVAL"),
+		},
+		Middleware: Middleware{
+			ChaosFile:     p.string("CHAOS_CONFIG_FILE"),
+			RateLimitFile: p.string("RATE_LIMIT_CONFIG_FILE"),
+			AuthFile:      p.string("AUTH_CONFIG_FILE"),
+		},
+		Topology: Topology{
+			File:    p.string("TOPOLOGY_FILE"),
+			Service: p.string("TOPOLOGY_SERVICE"),
+		},
+		Record: Record{
+			File:    p.string("RECORD_FILE"),
+			Headers: p.list("RECORD_HEADERS"),
+		},
+		Redact: Redact{
+			QueryParams: p.list("REDACT_QUERY_PARAMS"),
+			Headers:     p.list("REDACT_HEADERS"),
+		},
+		ReloadInterval: p.duration("CONFIG_RELOAD_INTERVAL"),
+		values:         values,
+	}
+
+	role, err := ParseRole(values["SERVICE_ROLE"])
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.Role = role
+	// a demo process has no servico-b client, so EXTERNAL_CALL_URL keeps
+	// naming the URL its page calls
+	if cfg.Page.ExternalCallURL == "" && role == RoleDemo {
+		cfg.Page.ExternalCallURL = cfg.ServicoB.URL
+	}
+	if s := cfg.Page.ExternalCallURL; s != "" {
+		if u, err := url.Parse(s); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Contains(s, ",") {
+			errs = append(errs, fmt.Errorf("PAGE_EXTERNAL_CALL_URL: %q is not a single http or https URL", s))
+		}
+	}
+	if r := cfg.Tracing.SampleRatio; r < 0 || r > 1 {
+		errs = append(errs, fmt.Errorf("TRACE_SAMPLE_RATIO: %v is not between 0 and 1", r))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Effective returns the value in use for every setting, redacting secrets
+func (c *Config) Effective() []EffectiveValue {
+	values := make([]EffectiveValue, 0, len(Settings))
+	for _, s := range Settings {
+		value := c.values[s.Key]
+		if s.Secret && value != "" {
+			value = "[REDACTED]"
+		}
+		values = append(values, EffectiveValue{Key: s.Key, Value: value})
+	}
+	return values
+}
+
+// Applied returns the values in use once c is reloaded into a process
+// started with startup: the settings that need a restart keep their startup
+// values
+func (c *Config) Applied(startup *Config) []EffectiveValue {
+	values, initial := c.Effective(), startup.Effective()
+	for i, s := range Settings {
+		if !s.Reloadable {
+			values[i] = initial[i]
+		}
+	}
+	return values
+}
+
+// Changed returns the settings that differ from old and cannot be applied
+// without a restart
+func (c *Config) Changed(old *Config) []string {
+	var keys []string
+	for _, s := range Settings {
+		if !s.Reloadable && c.values[s.Key] != old.values[s.Key] {
+			keys = append(keys, s.Key)
+		}
+	}
+	return keys
+}
+
+// parser reads values already checked by Setting.validate
+type parser struct {
+	values map[string]string
+}
+
+func (p parser) string(key string) string {
+	return p.values[key]
+}
+
+func (p parser) int(key string) int {
+	n, _ := parseInt(p.values[key])
+	return n
+}
+
+func (p parser) float(key string) float64 {
+	f, _ := parseFloat(p.values[key])
+	return f
+}
+
+func (p parser) duration(key string) time.Duration {
+	d, _ := parseDuration(p.values[key])
+	return d
+}
+
+// list splits a comma separated value, dropping empty items
+func (p parser) list(key string) []string {
+	var items []string
+	for _, item := range strings.Split(p.values[key], ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
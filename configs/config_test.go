@@ -0,0 +1,209 @@
+package configs
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// load runs a Loader over args with the YAML file content, if any
+func load(t *testing.T, file string, args ...string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader(fs)
+	if file != "" {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"-config", path}, args...)
+	}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return loader.Load()
+}
+
+func TestLoader_Precedence(t *testing.T) {
+	file := "WEB_SERVER_PORT: \":7070\"\nweather_api_rps: 2\ntitle: from file\n"
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		wantPort string
+		wantRPS  float64
+	}{
+		{name: "should read the file over the defaults", wantPort: ":7070", wantRPS: 2},
+		{
+			name:     "should read the environment over the file",
+			env:      map[string]string{"WEB_SERVER_PORT": ":6060"},
+			wantPort: ":6060",
+			wantRPS:  2,
+		},
+		{
+			name:     "should read the flags over the environment",
+			env:      map[string]string{"WEB_SERVER_PORT": ":6060"},
+			args:     []string{"-web-server-port", ":5050", "-weather-api-rps", "0.5"},
+			wantPort: ":5050",
+			wantRPS:  0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			cfg, err := load(t, file, tt.args...)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Server.Port != tt.wantPort || cfg.WeatherAPI.RPS != tt.wantRPS {
+				t.Errorf("Load() port = %q, rps = %v, want %q, %v", cfg.Server.Port, cfg.WeatherAPI.RPS, tt.wantPort, tt.wantRPS)
+			}
+			if cfg.Page.Title != "from file" || cfg.Server.ShutdownGracePeriod != 15*time.Second {
+				t.Errorf("Load() title = %q, grace = %s, want the file and default values", cfg.Page.Title, cfg.Server.ShutdownGracePeriod)
+			}
+		})
+	}
+}
+
+func TestLoader_Typed(t *testing.T) {
+	t.Setenv("SERVICE_ROLE", "A")
+	t.Setenv("EXTERNAL_CALL_URL", "http://servico-b:8181")
+	t.Setenv("RECORD_HEADERS", "Accept, X-Request-Id,")
+	t.Setenv("RESPONSE_TIME", "250")
+
+	cfg, err := load(t, "")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Role != RoleA || cfg.ServicoB.URL != "http://servico-b:8181" || cfg.Page.ExternalCallURL != "" {
+		t.Errorf("Load() role = %q, servico-b = %q, page = %q", cfg.Role, cfg.ServicoB.URL, cfg.Page.ExternalCallURL)
+	}
+	if want := []string{"Accept", "X-Request-Id"}; !reflect.DeepEqual(cfg.Record.Headers, want) {
+		t.Errorf("Record.Headers = %v, want %v", cfg.Record.Headers, want)
+	}
+	if cfg.Page.ResponseTime != 250*time.Millisecond {
+		t.Errorf("Page.ResponseTime = %s, want 250ms", cfg.Page.ResponseTime)
+	}
+	if cfg.ServicoB.MaxAttempts != 3 || cfg.Tracing.SampleRatio != 1 {
+		t.Errorf("defaults not applied: %+v", cfg.ServicoB)
+	}
+}
+
+func TestLoader_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		want []string
+	}{
+		{
+			name: "should report every invalid value at once",
+			env:  map[string]string{"SERVICO_B_MAX_ATTEMPTS": "three", "HEALTH_CACHE_TTL": "10"},
+			want: []string{"SERVICO_B_MAX_ATTEMPTS", "HEALTH_CACHE_TTL"},
+		},
+		{
+			name: "should reject an unknown setting in the file",
+			file: "WEATHER_API_RSP: 2\n",
+			want: []string{`unknown setting "weather_api_rsp"`},
+		},
+		{
+			name: "should check the sampling ratio",
+			env:  map[string]string{"TRACE_SAMPLE_RATIO": "1.5"},
+			want: []string{"TRACE_SAMPLE_RATIO"},
+		},
+		{
+			name: "should reject a list of URLs for the demo page",
+			env:  map[string]string{"SERVICE_ROLE": "demo", "EXTERNAL_CALL_URL": "http://a:8181,http://b:8181"},
+			want: []string{"PAGE_EXTERNAL_CALL_URL"},
+		},
+		{
+			name: "should reject a DNS spec for the page",
+			env:  map[string]string{"PAGE_EXTERNAL_CALL_URL": "dns://servico-b:8181"},
+			want: []string{"PAGE_EXTERNAL_CALL_URL"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := load(t, tt.file)
+			if err == nil {
+				t.Fatal("Load() should fail")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load() error = %q, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_Effective(t *testing.T) {
+	t.Setenv("WEATHER_API_KEY", "super-secret")
+
+	cfg, err := load(t, "")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for _, v := range cfg.Effective() {
+		if v.Key == "WEATHER_API_KEY" && v.Value != "[REDACTED]" {
+			t.Errorf("WEATHER_API_KEY = %q, want it redacted", v.Value)
+		}
+	}
+}
+
+func TestConfig_Changed(t *testing.T) {
+	old, err := load(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TRACE_SAMPLE_RATIO", "0.1")
+	t.Setenv("WEB_SERVER_PORT", ":9999")
+	cfg, err := load(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := cfg.Changed(old), []string{"WEB_SERVER_PORT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Changed() = %v, want only the settings needing a restart %v", got, want)
+	}
+}
+
+func TestConfig_Applied(t *testing.T) {
+	startup, err := load(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TRACE_SAMPLE_RATIO", "0.1")
+	t.Setenv("WEB_SERVER_PORT", ":9999")
+	cfg, err := load(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(map[string]string)
+	for _, v := range cfg.Applied(startup) {
+		values[v.Key] = v.Value
+	}
+	if values["TRACE_SAMPLE_RATIO"] != "0.1" || values["WEB_SERVER_PORT"] != ":8080" {
+		t.Errorf("Applied() = %v, want the reloaded ratio and the startup port", values)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := Default()
+	if cfg.Role != RoleAll || cfg.Server.Port != ":8080" || cfg.WeatherAPI.KeyCooldown != 15*time.Minute {
+		t.Errorf("Default() = %+v, want the setting defaults", cfg)
+	}
+}
@@ -0,0 +1,55 @@
+package configs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Role selects which routes, dependencies and background workers a process
+// starts
+type Role string
+
+const (
+	// RoleA serves /weather/servico-a and calls servico-b
+	RoleA Role = "a"
+	// RoleB serves /weather/servico-b/{zipcode} and calls ViaCEP and WeatherAPI
+	RoleB Role = "b"
+	// RoleDemo serves the index page, which calls PAGE_EXTERNAL_CALL_URL
+	RoleDemo Role = "demo"
+	// RoleAll serves every route in a single process
+	RoleAll Role = "all"
+)
+
+// ParseRole parses a SERVICE_ROLE value, defaulting to RoleAll when empty
+func ParseRole(s string) (Role, error) {
+	switch role := Role(strings.ToLower(strings.TrimSpace(s))); role {
+	case "":
+		return RoleAll, nil
+	case RoleA, RoleB, RoleDemo, RoleAll:
+		return role, nil
+	}
+	return "", fmt.Errorf("invalid SERVICE_ROLE %q: must be one of a, b, demo, all", s)
+}
+
+// ServesA reports whether the role serves servico-a
+func (r Role) ServesA() bool {
+	return r == RoleA || r == RoleAll
+}
+
+// ServesB reports whether the role serves servico-b
+func (r Role) ServesB() bool {
+	return r == RoleB || r == RoleAll
+}
+
+// ServesDemo reports whether the role serves the index page
+func (r Role) ServesDemo() bool {
+	return r == RoleDemo || r == RoleAll
+}
+
+// Validate checks that the dependencies required by the role are configured
+func (r Role) Validate(externalCallURL string) error {
+	if r.ServesA() && strings.TrimSpace(externalCallURL) == "" {
+		return fmt.Errorf("SERVICE_ROLE %q requires EXTERNAL_CALL_URL with the servico-b URL", r)
+	}
+	return nil
+}
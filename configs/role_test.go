@@ -0,0 +1,54 @@
+package configs
+
+import "testing"
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		want        Role
+		expectError bool
+	}{
+		{name: "should default to all", value: "", want: RoleAll},
+		{name: "should parse role a", value: "a", want: RoleA},
+		{name: "should parse role b ignoring case and spaces", value: " B ", want: RoleB},
+		{name: "should parse role demo", value: "demo", want: RoleDemo},
+		{name: "should reject unknown roles", value: "c", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRole(tt.value)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseRole() error = %v, expectError %v", err, tt.expectError)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRole() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRole_Validate(t *testing.T) {
+	tests := []struct {
+		name            string
+		role            Role
+		externalCallURL string
+		expectError     bool
+	}{
+		{name: "should require the servico-b URL for role a", role: RoleA, expectError: true},
+		{name: "should require the servico-b URL for role all", role: RoleAll, expectError: true},
+		{name: "should accept role a with the servico-b URL", role: RoleA, externalCallURL: "http://goapp2:8181/weather/servico-b"},
+		{name: "should not require the servico-b URL for role b", role: RoleB},
+		{name: "should not require the servico-b URL for role demo", role: RoleDemo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.role.Validate(tt.externalCallURL)
+			if (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package configs
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Kind is the type a setting value must parse as
+type Kind int
+
+const (
+	String Kind = iota
+	Int
+	Float
+	Duration
+)
+
+// Setting describes a configuration key read from the environment, the
+// config file or the flags
+type Setting struct {
+	Key     string
+	Kind    Kind
+	Default any
+	Secret  bool
+	// Reloadable settings are applied without a restart
+	Reloadable bool
+}
+
+// Settings lists every configuration key known by the binary
+var Settings = []Setting{
+	{Key: "SERVICE_ROLE", Default: "all"},
+	{Key: "WEB_SERVER_PORT", Default: ":8080"},
+	{Key: "ADMIN_PORT", Default: "127.0.0.1:9090"},
+	{Key: "TLS_CERT_FILE"},
+	{Key: "TLS_KEY_FILE"},
+	{Key: "TLS_CLIENT_CA_FILE"},
+	{Key: "TLS_CLIENT_AUTH"},
+	{Key: "TLS_RELOAD_INTERVAL", Kind: Duration, Default: "10s"},
+	{Key: "SHUTDOWN_GRACE_PERIOD", Kind: Duration, Default: "15s"},
+	{Key: "SHUTDOWN_READINESS_DELAY", Kind: Duration, Default: "0s"},
+	{Key: "CONFIG_RELOAD_INTERVAL", Kind: Duration, Default: "10s"},
+	{Key: "HEALTH_CHECK_TIMEOUT", Kind: Duration, Default: "2s"},
+	{Key: "HEALTH_CACHE_TTL", Kind: Duration, Default: "10s"},
+	{Key: "HEALTH_EXTERNAL_CACHE_TTL", Kind: Duration, Default: "1m"},
+	{Key: "WEATHER_API_KEY", Secret: true},
+	{Key: "WEATHER_API_KEYS", Secret: true},
+	{Key: "WEATHER_API_KEYS_FILE"},
+	{Key: "WEATHER_API_KEY_COOLDOWN", Kind: Duration, Default: "15m"},
+	{Key: "WEATHER_API_RPS", Kind: Float, Default: 0},
+	{Key: "WEATHER_API_BURST", Kind: Int, Default: 0},
+	{Key: "WEATHER_API_MONTHLY_BUDGET", Kind: Int, Default: 0},
+	{Key: "WEATHER_API_QUOTA_FILE"},
+	{Key: "OTEL_SERVICE_NAME"},
+	{Key: "ZIPKIN_ENDPOINT", Default: "http://zipkin:9411/api/v2/spans"},
+	{Key: "REQUEST_NAME_OTEL"},
+	{Key: "TRACE_SAMPLE_RATIO", Kind: Float, Default: 1, Reloadable: true},
+	{Key: "TITLE"},
+	{Key: "BACKGROUND_COLOR"},
+	{Key: "LOOKUP_URL"},
+	{Key: "LOOKUP_API_KEY", Secret: true},
+	{Key: "TRACING_UI_URL", Default: "http://localhost:9411/zipkin/traces/{trace_id}"},
+	{Key: "RESPONSE_TIME", Kind: Int, Reloadable: true},
+	{Key: "EXTERNAL_CALL_URL"},
+	{Key: "EXTERNAL_CALL_METHOD"},
+	{Key: "PAGE_EXTERNAL_CALL_URL"},
+	{Key: "CHAOS_CONFIG_FILE", Reloadable: true},
+	{Key: "RATE_LIMIT_CONFIG_FILE", Reloadable: true},
+	{Key: "AUTH_CONFIG_FILE"},
+	{Key: "TOPOLOGY_FILE"},
+	{Key: "TOPOLOGY_SERVICE"},
+	{Key: "RECORD_FILE"},
+	{Key: "RECORD_HEADERS", Default: "Content-Type,Accept,User-Agent"},
+	{Key: "REDACT_QUERY_PARAMS"},
+	{Key: "REDACT_HEADERS"},
+	{Key: "SERVICO_B_ATTEMPT_TIMEOUT", Kind: Duration, Default: "5s"},
+	{Key: "SERVICO_B_MAX_ATTEMPTS", Kind: Int, Default: 3},
+	{Key: "SERVICO_B_BACKOFF_BASE", Kind: Duration, Default: "100ms"},
+	{Key: "SERVICO_B_BACKOFF_MAX", Kind: Duration, Default: "2s"},
+	{Key: "SERVICO_B_BREAKER_THRESHOLD", Kind: Int, Default: 5},
+	{Key: "SERVICO_B_BREAKER_COOLDOWN", Kind: Duration, Default: "10s"},
+	{Key: "SERVICO_B_LB_POLICY", Default: "round_robin"},
+	{Key: "SERVICO_B_RESOLVE_INTERVAL", Kind: Duration, Default: "30s"},
+	{Key: "SERVICO_B_HEALTH_CHECK_PATH", Default: "/healthz"},
+	{Key: "SERVICO_B_HEALTH_CHECK_INTERVAL", Kind: Duration, Default: "10s"},
+	{Key: "SERVICO_B_HEALTH_CHECK_TIMEOUT", Kind: Duration, Default: "1s"},
+	{Key: "SERVICO_B_HEDGE_PERCENTILE", Kind: Float, Default: 0},
+	{Key: "SERVICO_B_HEDGE_MIN_DELAY", Kind: Duration, Default: "50ms"},
+	{Key: "SERVICO_B_HEDGE_MAX_DELAY", Kind: Duration, Default: "1s"},
+	{Key: "SERVICO_B_CA_FILE"},
+	{Key: "SERVICO_B_CLIENT_CERT_FILE"},
+	{Key: "SERVICO_B_CLIENT_KEY_FILE"},
+	{Key: "SERVICO_B_SERVER_NAME"},
+	{Key: "SERVICO_B_API_KEY", Secret: true},
+}
+
+// EffectiveValue is the value in use for a setting, with secrets redacted
+type EffectiveValue struct {
+	Key   string
+	Value string
+}
+
+func (s Setting) validate(value string) error {
+	var err error
+	switch s.Kind {
+	case Int:
+		_, err = parseInt(value)
+	case Float:
+		_, err = parseFloat(value)
+	case Duration:
+		_, err = parseDuration(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: invalid value %q", s.Key, value)
+	}
+	return nil
+}
+
+// the parse functions read an empty value as zero
+
+func parseInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func parseFloat(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
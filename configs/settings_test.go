@@ -0,0 +1,31 @@
+package configs
+
+import (
+	"testing"
+)
+
+func TestSetting_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		setting     Setting
+		value       string
+		expectError bool
+	}{
+		{name: "should accept empty values", setting: Setting{Key: "K", Kind: Duration}},
+		{name: "should accept a duration", setting: Setting{Key: "K", Kind: Duration}, value: "250ms"},
+		{name: "should reject an invalid duration", setting: Setting{Key: "K", Kind: Duration}, value: "250", expectError: true},
+		{name: "should accept an int", setting: Setting{Key: "K", Kind: Int}, value: "3"},
+		{name: "should reject an invalid int", setting: Setting{Key: "K", Kind: Int}, value: "three", expectError: true},
+		{name: "should accept a float", setting: Setting{Key: "K", Kind: Float}, value: "0.95"},
+		{name: "should accept any string", setting: Setting{Key: "K"}, value: "anything"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.setting.validate(tt.value)
+			if (err != nil) != tt.expectError {
+				t.Errorf("validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package configs
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// fileState is what a watched file is compared by; a missing file is the
+// zero value
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func stat(path string) fileState {
+	// Stat follows symlinks, so a mounted ConfigMap swapping its target is
+	// seen as a change
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
+
+// Watch calls reload when one of the files changes, checked every interval,
+// or when a value arrives on trigger (e.g. SIGHUP), until ctx is done. files
+// is called again after each reload, since the reload may point elsewhere.
+func Watch(ctx context.Context, interval time.Duration, trigger <-chan os.Signal, files func() []string, reload func()) {
+	snapshot := func() map[string]fileState {
+		states := make(map[string]fileState)
+		for _, path := range files() {
+			if path != "" {
+				states[path] = stat(path)
+			}
+		}
+		return states
+	}
+	states := snapshot()
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-trigger:
+		case <-tick:
+			changed := false
+			for path, state := range states {
+				if stat(path) != state {
+					changed = true
+				}
+			}
+			if !changed {
+				continue
+			}
+		}
+		reload()
+		states = snapshot()
+	}
+}
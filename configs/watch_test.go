@@ -0,0 +1,57 @@
+package configs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("a: 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trigger := make(chan os.Signal)
+	reloads := make(chan struct{}, 10)
+	done := make(chan struct{})
+	go func() {
+		Watch(ctx, 10*time.Millisecond, trigger, func() []string { return []string{path, ""} }, func() { reloads <- struct{}{} })
+		close(done)
+	}()
+
+	expectReload := func(reason string) {
+		t.Helper()
+		select {
+		case <-reloads:
+		case <-time.After(time.Second):
+			t.Fatalf("no reload after %s", reason)
+		}
+	}
+
+	select {
+	case <-reloads:
+		t.Fatal("reloaded without a change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(path, []byte("a: 22\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expectReload("a file change")
+
+	trigger <- syscall.SIGHUP
+	expectReload("SIGHUP")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not return after the context was done")
+	}
+}
@@ -0,0 +1,79 @@
+package cep
+
+import (
+	"regexp"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// UFKey is the span attribute holding the UF inferred from a CEP
+const UFKey = attribute.Key("cep.uf")
+
+var zipCodeFormat = regexp.MustCompile(`^\d{8}$`)
+
+// ufRange is an inclusive range of five-digit CEP prefixes allocated to a UF
+type ufRange struct {
+	From int
+	To   int
+	UF   string
+}
+
+// ufRanges is the Correios allocation of CEP prefixes per federative unit.
+// Prefixes outside of every range (e.g. 00000-00999) are not allocated.
+var ufRanges = []ufRange{
+	{From: 1000, To: 19999, UF: "SP"},
+	{From: 20000, To: 28999, UF: "RJ"},
+	{From: 29000, To: 29999, UF: "ES"},
+	{From: 30000, To: 39999, UF: "MG"},
+	{From: 40000, To: 48999, UF: "BA"},
+	{From: 49000, To: 49999, UF: "SE"},
+	{From: 50000, To: 56999, UF: "PE"},
+	{From: 57000, To: 57999, UF: "AL"},
+	{From: 58000, To: 58999, UF: "PB"},
+	{From: 59000, To: 59999, UF: "RN"},
+	{From: 60000, To: 63999, UF: "CE"},
+	{From: 64000, To: 64999, UF: "PI"},
+	{From: 65000, To: 65999, UF: "MA"},
+	{From: 66000, To: 68899, UF: "PA"},
+	{From: 68900, To: 68999, UF: "AP"},
+	{From: 69000, To: 69299, UF: "AM"},
+	{From: 69300, To: 69399, UF: "RR"},
+	{From: 69400, To: 69899, UF: "AM"},
+	{From: 69900, To: 69999, UF: "AC"},
+	{From: 70000, To: 72799, UF: "DF"},
+	{From: 72800, To: 72999, UF: "GO"},
+	{From: 73000, To: 73699, UF: "DF"},
+	{From: 73700, To: 76799, UF: "GO"},
+	{From: 76800, To: 76999, UF: "RO"},
+	{From: 77000, To: 77999, UF: "TO"},
+	{From: 78000, To: 78899, UF: "MT"},
+	{From: 79000, To: 79999, UF: "MS"},
+	{From: 80000, To: 87999, UF: "PR"},
+	{From: 88000, To: 89999, UF: "SC"},
+	{From: 90000, To: 99999, UF: "RS"},
+}
+
+// IsValidFormat reports whether zipcode is made of exactly eight digits
+func IsValidFormat(zipcode string) bool {
+	return zipCodeFormat.MatchString(zipcode)
+}
+
+// LookupUF infers the UF of a CEP from its prefix without any network call.
+// It returns false when the CEP is malformed or falls in an unallocated range.
+func LookupUF(zipcode string) (string, bool) {
+	if !IsValidFormat(zipcode) {
+		return "", false
+	}
+
+	prefix := 0
+	for _, c := range zipcode[:5] {
+		prefix = prefix*10 + int(c-'0')
+	}
+
+	for _, r := range ufRanges {
+		if prefix >= r.From && prefix <= r.To {
+			return r.UF, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,78 @@
+package cep
+
+import "testing"
+
+func TestLookupUF(t *testing.T) {
+	tests := []struct {
+		name    string
+		zipCode string
+		wantUF  string
+		wantOk  bool
+	}{
+		{
+			name:    "should infer SP for a Sao Paulo zipcode",
+			zipCode: "01001000",
+			wantUF:  "SP",
+			wantOk:  true,
+		},
+		{
+			name:    "should infer RS for the last allocated prefix",
+			zipCode: "99999999",
+			wantUF:  "RS",
+			wantOk:  true,
+		},
+		{
+			name:    "should infer DF for a Brasilia zipcode",
+			zipCode: "70040010",
+			wantUF:  "DF",
+			wantOk:  true,
+		},
+		{
+			name:    "should infer GO between the two DF ranges",
+			zipCode: "72850000",
+			wantUF:  "GO",
+			wantOk:  true,
+		},
+		{
+			name:    "should infer RR inside the AM ranges",
+			zipCode: "69301000",
+			wantUF:  "RR",
+			wantOk:  true,
+		},
+		{
+			name:    "should reject the unallocated 00000 prefix",
+			zipCode: "00000000",
+			wantOk:  false,
+		},
+		{
+			name:    "should reject the unallocated 00999 prefix",
+			zipCode: "00999999",
+			wantOk:  false,
+		},
+		{
+			name:    "should reject a malformed zipcode",
+			zipCode: "1234567A",
+			wantOk:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUF, gotOk := LookupUF(tt.zipCode)
+			if gotOk != tt.wantOk {
+				t.Errorf("LookupUF() ok = %v, want %v", gotOk, tt.wantOk)
+			}
+			if gotUF != tt.wantUF {
+				t.Errorf("LookupUF() uf = %q, want %q", gotUF, tt.wantUF)
+			}
+		})
+	}
+}
+
+func TestUFRangesDoNotOverlap(t *testing.T) {
+	for i := 1; i < len(ufRanges); i++ {
+		if ufRanges[i].From <= ufRanges[i-1].To {
+			t.Errorf("range %d (%s) overlaps range %d (%s)", i, ufRanges[i].UF, i-1, ufRanges[i-1].UF)
+		}
+	}
+}
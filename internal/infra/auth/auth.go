@@ -0,0 +1,280 @@
+// Package auth authenticates inbound requests with API keys or JWTs
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gopkg.in/yaml.v3"
+)
+
+// Route policies
+const (
+	Public = "public"
+	Key    = "key"
+	JWT    = "jwt"
+)
+
+// Authentication methods recorded on the principal
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// DefaultAPIKeyHeader carries the API key when the configuration does not
+// set one
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// hashPrefix marks the algorithm of the stored API key hashes
+const hashPrefix = "sha256:"
+
+// Span attributes describing the principal
+const (
+	EndUserIDKey    = attribute.Key("enduser.id")
+	EndUserScopeKey = attribute.Key("enduser.scope")
+	MethodKey       = attribute.Key("auth.method")
+)
+
+// APIKey is a static key, stored as the hex SHA-256 of its value
+type APIKey struct {
+	Name   string   `yaml:"name"`
+	Hash   string   `yaml:"hash"`
+	Scopes []string `yaml:"scopes"`
+}
+
+// JWTConfig validates bearer tokens against the keys of a local JWKS file
+type JWTConfig struct {
+	JWKSFile string `yaml:"jwks_file"`
+	// Issuer and Audience are checked when set
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// Leeway tolerates clock skew on exp and nbf
+	Leeway time.Duration `yaml:"leeway"`
+}
+
+// Route is the policy of a route and the scopes its principals need
+type Route struct {
+	Policy string   `yaml:"policy"`
+	Scopes []string `yaml:"scopes"`
+}
+
+// Config maps route names to their policies; routes not listed are public
+type Config struct {
+	APIKeyHeader string           `yaml:"api_key_header"`
+	APIKeys      []APIKey         `yaml:"api_keys"`
+	JWT          JWTConfig        `yaml:"jwt"`
+	Routes       map[string]Route `yaml:"routes"`
+}
+
+// LoadConfig reads a YAML auth configuration. An empty path yields an empty
+// configuration, which leaves every route public.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read auth config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse auth config: %w", err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks the key hashes and the route policies
+func (c Config) Validate() error {
+	for _, key := range c.APIKeys {
+		if key.Name == "" {
+			return fmt.Errorf("api key without a name")
+		}
+		if _, err := decodeHash(key.Hash); err != nil {
+			return fmt.Errorf("api key %q: %w", key.Name, err)
+		}
+	}
+	for name, route := range c.Routes {
+		switch route.Policy {
+		case "", Public:
+		case Key:
+			if len(c.APIKeys) == 0 {
+				return fmt.Errorf("auth route %q: policy key needs api_keys", name)
+			}
+		case JWT:
+			if c.JWT.JWKSFile == "" {
+				return fmt.Errorf("auth route %q: policy jwt needs jwt.jwks_file", name)
+			}
+		default:
+			return fmt.Errorf("auth route %q: unknown policy %q", name, route.Policy)
+		}
+	}
+	return nil
+}
+
+func decodeHash(hash string) ([]byte, error) {
+	digest, err := hex.DecodeString(strings.TrimPrefix(hash, hashPrefix))
+	if err != nil || len(digest) != sha256.Size {
+		return nil, errors.New("hash must be sha256: followed by 64 hex digits")
+	}
+	return digest, nil
+}
+
+// HashKey returns the value to store in the configuration for key
+func HashKey(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hashPrefix + hex.EncodeToString(digest[:])
+}
+
+// Principal is the authenticated caller
+type Principal struct {
+	// Subject is the API key name or the JWT sub claim
+	Subject string
+	Method  string
+	Scopes  []string
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of the request, if it was authenticated
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Attributes returns the span attributes describing the principal of ctx,
+// if any
+func Attributes(ctx context.Context) []attribute.KeyValue {
+	p, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return []attribute.KeyValue{
+		EndUserIDKey.String(p.Subject),
+		EndUserScopeKey.String(strings.Join(p.Scopes, " ")),
+		MethodKey.String(p.Method),
+	}
+}
+
+type apiKey struct {
+	APIKey
+	digest []byte
+}
+
+// Authenticator enforces the route policies of its configuration
+type Authenticator struct {
+	cfg  Config
+	keys []apiKey
+	jwks *JWKS
+	now  func() time.Time
+}
+
+// NewAuthenticator creates an Authenticator for cfg, loading its JWKS file
+func NewAuthenticator(cfg Config) (*Authenticator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.APIKeyHeader == "" {
+		cfg.APIKeyHeader = DefaultAPIKeyHeader
+	}
+
+	a := &Authenticator{cfg: cfg, now: time.Now}
+	for _, key := range cfg.APIKeys {
+		digest, _ := decodeHash(key.Hash)
+		a.keys = append(a.keys, apiKey{APIKey: key, digest: digest})
+	}
+	if cfg.JWT.JWKSFile != "" {
+		jwks, err := LoadJWKS(cfg.JWT.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.jwks = jwks
+	}
+	return a, nil
+}
+
+// Route returns the middleware enforcing the policy of route. A nil
+// Authenticator leaves every route public.
+func (a *Authenticator) Route(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if a == nil {
+			return next
+		}
+		policy, ok := a.cfg.Routes[route]
+		if !ok || policy.Policy == "" || policy.Policy == Public {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := a.authenticate(r, policy.Policy)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", a.challenge(policy.Policy))
+				writeProblem(w, r, http.StatusUnauthorized, err.Error())
+				return
+			}
+			for _, scope := range policy.Scopes {
+				if !slices.Contains(principal.Scopes, scope) {
+					writeProblem(w, r, http.StatusForbidden, fmt.Sprintf("missing scope %q", scope))
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+func (a *Authenticator) authenticate(r *http.Request, policy string) (*Principal, error) {
+	if policy == Key {
+		return a.authenticateKey(r.Header.Get(a.cfg.APIKeyHeader))
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, errors.New("missing bearer token")
+	}
+	claims, err := a.jwks.Verify(token, a.cfg.JWT, a.now())
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Subject: claims.Subject, Method: MethodJWT, Scopes: claims.Scopes()}, nil
+}
+
+// authenticateKey compares the hash of the presented key with every stored
+// hash in constant time
+func (a *Authenticator) authenticateKey(presented string) (*Principal, error) {
+	if presented == "" {
+		return nil, errors.New("missing API key")
+	}
+	digest := sha256.Sum256([]byte(presented))
+	var match *apiKey
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(digest[:], a.keys[i].digest) == 1 {
+			match = &a.keys[i]
+		}
+	}
+	if match == nil {
+		return nil, errors.New("invalid API key")
+	}
+	return &Principal{Subject: match.Name, Method: MethodAPIKey, Scopes: match.Scopes}, nil
+}
+
+func (a *Authenticator) challenge(policy string) string {
+	if policy == Key {
+		return fmt.Sprintf("ApiKey header=%q", a.cfg.APIKeyHeader)
+	}
+	return `Bearer realm="microservice"`
+}
@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sign builds a compact JWS for claims with an RSA or EC key
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+
+	digest := hashes[alg].New()
+	digest.Write([]byte(input))
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, k, hashes[alg], digest.Sum(nil))
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, k, digest.Sum(nil))
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+	}
+	return input + "." + b64(signature)
+}
+
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	t.Helper()
+	set := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "alg": "RS256", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+	}}
+	data, _ := json.Marshal(set)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAuthenticator_Route(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	a, err := NewAuthenticator(Config{
+		APIKeys: []APIKey{
+			{Name: "loadtest", Hash: HashKey("s3cret"), Scopes: []string{"weather:read"}},
+			{Name: "readonly", Hash: HashKey("other")},
+		},
+		JWT: JWTConfig{JWKSFile: writeJWKS(t, rsaKey, ecKey), Issuer: "lab", Audience: "weather"},
+		Routes: map[string]Route{
+			"keyed":  {Policy: Key, Scopes: []string{"weather:read"}},
+			"jwt":    {Policy: JWT, Scopes: []string{"weather:read"}},
+			"public": {Policy: Public},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+	a.now = func() time.Time { return testNow }
+
+	var seen *Principal
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = FromContext(r.Context())
+	})
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{"sub": "user-1", "iss": "lab", "aud": []string{"weather"}, "exp": testNow.Add(time.Minute).Unix(), "scope": "weather:read profile"}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name        string
+		route       string
+		header      string
+		value       string
+		wantStatus  int
+		wantSubject string
+	}{
+		{name: "should let public routes through", route: "public", wantStatus: http.StatusOK},
+		{name: "should let unlisted routes through", route: "other", wantStatus: http.StatusOK},
+		{name: "should require an API key", route: "keyed", wantStatus: http.StatusUnauthorized},
+		{name: "should reject an unknown API key", route: "keyed", header: DefaultAPIKeyHeader, value: "wrong", wantStatus: http.StatusUnauthorized},
+		{name: "should accept a valid API key", route: "keyed", header: DefaultAPIKeyHeader, value: "s3cret", wantStatus: http.StatusOK, wantSubject: "loadtest"},
+		{name: "should forbid an API key without the scope", route: "keyed", header: DefaultAPIKeyHeader, value: "other", wantStatus: http.StatusForbidden},
+		{name: "should require a bearer token", route: "jwt", wantStatus: http.StatusUnauthorized},
+		{name: "should accept an RS256 token", route: "jwt", header: "Authorization", value: "Bearer " + sign(t, "RS256", "rsa", rsaKey, claims(nil)), wantStatus: http.StatusOK, wantSubject: "user-1"},
+		{name: "should accept an ES256 token", route: "jwt", header: "Authorization", value: "Bearer " + sign(t, "ES256", "ec", ecKey, claims(nil)), wantStatus: http.StatusOK, wantSubject: "user-1"},
+		{name: "should reject a token signed by another key", route: "jwt", header: "Authorization", value: "Bearer " + sign(t, "RS256", "rsa", otherKey, claims(nil)), wantStatus: http.StatusUnauthorized},
+		{name: "should reject an expired token", route: "jwt", header: "Authorization", value: "Bearer " + sign(t, "RS256", "rsa", rsaKey, claims(map[string]any{"exp": testNow.Add(-time.Minute).Unix()})), wantStatus: http.StatusUnauthorized},
+		{name: "should reject another audience", route: "jwt", header: "Authorization", value: "Bearer " + sign(t, "RS256", "rsa", rsaKey, claims(map[string]any{"aud": "billing"})), wantStatus: http.StatusUnauthorized},
+		{name: "should reject the none algorithm", route: "jwt", header: "Authorization", value: "Bearer " + b64([]byte(`{"alg":"none"}`)) + "." + b64([]byte(`{"sub":"x"}`)) + ".", wantStatus: http.StatusUnauthorized},
+		{name: "should forbid a token without the scope", route: "jwt", header: "Authorization", value: "Bearer " + sign(t, "RS256", "rsa", rsaKey, claims(map[string]any{"scope": "profile"})), wantStatus: http.StatusForbidden},
+		{name: "should not accept an API key on a JWT route", route: "jwt", header: DefaultAPIKeyHeader, value: "s3cret", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = nil
+			req := httptest.NewRequest(http.MethodGet, "/weather", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			a.Route(tt.route)(handler).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				var problem Problem
+				if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil || problem.Status != tt.wantStatus || problem.Instance != "/weather" {
+					t.Errorf("problem = %+v (%v), want status %d", problem, err, tt.wantStatus)
+				}
+				if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+					t.Errorf("Content-Type = %q", ct)
+				}
+				if tt.wantStatus == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+					t.Error("WWW-Authenticate not set on 401")
+				}
+				return
+			}
+			var subject string
+			if seen != nil {
+				subject = seen.Subject
+			}
+			if subject != tt.wantSubject {
+				t.Errorf("principal subject = %q, want %q", subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	ctx := WithPrincipal(t.Context(), &Principal{Subject: "loadtest", Method: MethodAPIKey, Scopes: []string{"a", "b"}})
+	got := map[string]string{}
+	for _, kv := range Attributes(ctx) {
+		got[string(kv.Key)] = kv.Value.AsString()
+	}
+	want := map[string]string{"enduser.id": "loadtest", "enduser.scope": "a b", "auth.method": "api_key"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	if attrs := Attributes(t.Context()); attrs != nil {
+		t.Errorf("Attributes() without a principal = %v, want nil", attrs)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{name: "should accept an empty config", cfg: Config{}},
+		{name: "should reject a raw key in place of the hash", cfg: Config{APIKeys: []APIKey{{Name: "k", Hash: "s3cret"}}}, wantErr: "sha256"},
+		{name: "should reject an unknown policy", cfg: Config{Routes: map[string]Route{"r": {Policy: "basic"}}}, wantErr: "unknown policy"},
+		{name: "should need keys for the key policy", cfg: Config{Routes: map[string]Route{"r": {Policy: Key}}}, wantErr: "api_keys"},
+		{name: "should need a JWKS for the jwt policy", cfg: Config{Routes: map[string]Route{"r": {Policy: JWT}}}, wantErr: "jwks_file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
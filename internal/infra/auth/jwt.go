@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jwk is a JSON Web Key; only the RSA and EC public members are used
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type publicKey struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+// JWKS holds the public keys tokens are verified against
+type JWKS struct {
+	keys []publicKey
+}
+
+// LoadJWKS reads a JWK Set file with RSA and EC signing keys
+func LoadJWKS(path string) (*JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses a JWK Set, skipping encryption keys
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	jwks := &JWKS{}
+	for _, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %q: %w", k.Kid, err)
+		}
+		jwks.keys = append(jwks.keys, publicKey{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(jwks.keys) == 0 {
+		return nil, errors.New("JWKS has no signing keys")
+	}
+	return jwks, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Claims are the registered claims checked on a token, plus its scopes
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+	// Scope is space separated, as in OAuth 2.0; Scp is its array form
+	Scope string   `json:"scope"`
+	Scp   []string `json:"scp"`
+}
+
+// Scopes returns the scopes granted to the token
+func (c Claims) Scopes() []string {
+	if len(c.Scp) > 0 {
+		return c.Scp
+	}
+	return strings.Fields(c.Scope)
+}
+
+// audience accepts both a single string and an array
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+var hashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// Verify checks the signature of a compact JWS token and its claims at now
+func (s *JWKS) Verify(token string, cfg JWTConfig, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	hash, ok := hashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	digest := h.Sum(nil)
+	if !s.verifySignature(header.Kid, header.Alg, hash, digest, signature) {
+		return nil, errors.New("invalid token signature")
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+	if err := claims.validate(cfg, now); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// verifySignature tries the keys matching kid, or every key when the token
+// has none
+func (s *JWKS) verifySignature(kid, alg string, hash crypto.Hash, digest, signature []byte) bool {
+	for _, k := range s.keys {
+		if kid != "" && k.kid != kid {
+			continue
+		}
+		if k.alg != "" && k.alg != alg {
+			continue
+		}
+		switch key := k.key.(type) {
+		case *rsa.PublicKey:
+			if strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			size := (key.Curve.Params().BitSize + 7) / 8
+			if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+				continue
+			}
+			r := new(big.Int).SetBytes(signature[:size])
+			sig := new(big.Int).SetBytes(signature[size:])
+			if ecdsa.Verify(key, digest, r, sig) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c Claims) validate(cfg JWTConfig, now time.Time) error {
+	if c.ExpiresAt == nil {
+		return errors.New("token has no expiration")
+	}
+	if now.After(time.Unix(*c.ExpiresAt, 0).Add(cfg.Leeway)) {
+		return errors.New("token expired")
+	}
+	if c.NotBefore != nil && now.Add(cfg.Leeway).Before(time.Unix(*c.NotBefore, 0)) {
+		return errors.New("token not valid yet")
+	}
+	if cfg.Issuer != "" && c.Issuer != cfg.Issuer {
+		return errors.New("unexpected token issuer")
+	}
+	if cfg.Audience != "" && !slices.Contains(c.Audience, cfg.Audience) {
+		return errors.New("unexpected token audience")
+	}
+	if c.Subject == "" {
+		return errors.New("token has no subject")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,246 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+const tracerName = "github.com/samucadutra/lab-otel-goexpert/internal/infra/chaos"
+
+// Latency distributions
+const (
+	Fixed       = "fixed"
+	Uniform     = "uniform"
+	Normal      = "normal"
+	Exponential = "exponential"
+)
+
+// Latency describes the delay injected before a request is handled
+type Latency struct {
+	Distribution string        `yaml:"distribution"`
+	Value        time.Duration `yaml:"value"`
+	Min          time.Duration `yaml:"min"`
+	Max          time.Duration `yaml:"max"`
+	Mean         time.Duration `yaml:"mean"`
+	StdDev       time.Duration `yaml:"stddev"`
+}
+
+// Rule is the set of faults injected on a route
+type Rule struct {
+	Latency          *Latency `yaml:"latency"`
+	ErrorRate        float64  `yaml:"error_rate"`
+	ErrorStatusCodes []int    `yaml:"error_status_codes"`
+	AbortRate        float64  `yaml:"abort_rate"`
+}
+
+// Config maps route names to their rules
+type Config struct {
+	Routes map[string]Rule `yaml:"routes"`
+}
+
+// LoadConfig reads a YAML chaos configuration. An empty path yields an empty
+// configuration, which injects nothing.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read chaos config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse chaos config: %w", err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks every rule of the configuration
+func (c Config) Validate() error {
+	for route, rule := range c.Routes {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("chaos route %q: %w", route, err)
+		}
+	}
+	return nil
+}
+
+func (r Rule) validate() error {
+	if r.ErrorRate < 0 || r.ErrorRate > 1 {
+		return fmt.Errorf("error_rate must be between 0 and 1")
+	}
+	if r.AbortRate < 0 || r.AbortRate > 1 {
+		return fmt.Errorf("abort_rate must be between 0 and 1")
+	}
+	for _, code := range r.ErrorStatusCodes {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("invalid error status code %d", code)
+		}
+	}
+	if r.Latency == nil {
+		return nil
+	}
+	return r.Latency.Validate()
+}
+
+// Validate checks the distribution and its parameters
+func (l *Latency) Validate() error {
+	switch l.Distribution {
+	case Fixed, Uniform, Normal, Exponential:
+	default:
+		return fmt.Errorf("unknown latency distribution %q", l.Distribution)
+	}
+	if l.Distribution == Uniform && l.Max < l.Min {
+		return fmt.Errorf("latency max must not be lower than min")
+	}
+	return nil
+}
+
+// Sample draws a delay from the distribution using random, uniform in
+// [0, 1), and normal, a standard normal variate. A nil Latency yields zero.
+func (l *Latency) Sample(random, normal func() float64) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	var d float64
+	switch l.Distribution {
+	case Fixed:
+		d = float64(l.Value)
+	case Uniform:
+		d = float64(l.Min) + random()*float64(l.Max-l.Min)
+	case Normal:
+		d = float64(l.Mean) + normal()*float64(l.StdDev)
+	case Exponential:
+		d = -math.Log(1-random()) * float64(l.Mean)
+	}
+	return time.Duration(max(d, 0))
+}
+
+// Injector injects latency, errors and aborted connections on the routes of
+// its configuration. The configuration can be swapped at runtime with Update.
+type Injector struct {
+	cfg    atomic.Pointer[Config]
+	random func() float64
+	normal func() float64
+	tracer trace.Tracer
+}
+
+// NewInjector creates an Injector for cfg
+func NewInjector(cfg Config) *Injector {
+	i := &Injector{
+		random: rand.Float64,
+		normal: rand.NormFloat64,
+		tracer: otel.Tracer(tracerName),
+	}
+	i.Update(cfg)
+	return i
+}
+
+// Update replaces the configuration used by the next requests
+func (i *Injector) Update(cfg Config) {
+	i.cfg.Store(&cfg)
+}
+
+// Config returns the configuration in use
+func (i *Injector) Config() Config {
+	return *i.cfg.Load()
+}
+
+// Route returns the middleware injecting the faults configured for route.
+// The rule is looked up on every request, so updates apply immediately.
+func (i *Injector) Route(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule, ok := i.Config().Routes[route]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			latency := rule.Latency.Sample(i.random, i.normal)
+			abort := rule.AbortRate > 0 && i.random() < rule.AbortRate
+			status := 0
+			if !abort && rule.ErrorRate > 0 && i.random() < rule.ErrorRate {
+				status = i.errorStatus(rule.ErrorStatusCodes)
+			}
+			if latency <= 0 && !abort && status == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !i.inject(w, r, route, latency, abort, status) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// inject applies the faults in their own span and reports whether the
+// request should still reach the handler
+func (i *Injector) inject(w http.ResponseWriter, r *http.Request, route string, latency time.Duration, abort bool, status int) bool {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	_, span := i.tracer.Start(ctx, "chaos "+route, trace.WithAttributes(
+		attribute.String("chaos.route", route),
+		attribute.Int64("chaos.latency_ms", latency.Milliseconds()),
+		attribute.Bool("chaos.abort", abort),
+		attribute.Int("chaos.error_status_code", status),
+	))
+	defer span.End()
+
+	if latency > 0 {
+		if err := Wait(r.Context(), latency); err != nil {
+			span.AddEvent("request cancelled during injected latency")
+			span.SetStatus(codes.Error, err.Error())
+			return false
+		}
+	}
+
+	if abort {
+		span.SetStatus(codes.Error, "connection aborted by fault injection")
+		// the deferred span.End still runs, then net/http closes the
+		// connection without writing a response
+		panic(http.ErrAbortHandler)
+	}
+
+	if status != 0 {
+		span.SetStatus(codes.Error, "error injected by fault injection")
+		http.Error(w, http.StatusText(status), status)
+		return false
+	}
+	return true
+}
+
+func (i *Injector) errorStatus(codes []int) int {
+	if len(codes) == 0 {
+		return http.StatusInternalServerError
+	}
+	return codes[int(i.random()*float64(len(codes)))%len(codes)]
+}
+
+// Wait sleeps for d, returning early with the context error when ctx is done
+func Wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
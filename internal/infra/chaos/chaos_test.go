@@ -0,0 +1,183 @@
+package chaos
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestInjector(cfg Config, random float64) *Injector {
+	i := NewInjector(cfg)
+	i.random = func() float64 { return random }
+	i.normal = func() float64 { return 1 }
+	return i
+}
+
+func serve(i *Injector, route string, req *http.Request) (*httptest.ResponseRecorder, bool) {
+	called := false
+	handler := i.Route(route)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w, called
+}
+
+func TestInjector_Route(t *testing.T) {
+	tests := []struct {
+		name       string
+		rule       Rule
+		random     float64
+		wantStatus int
+		wantCalled bool
+		minElapsed time.Duration
+	}{
+		{
+			name:       "should pass through routes without faults",
+			rule:       Rule{},
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+		},
+		{
+			name:       "should inject fixed latency",
+			rule:       Rule{Latency: &Latency{Distribution: Fixed, Value: 20 * time.Millisecond}},
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+			minElapsed: 20 * time.Millisecond,
+		},
+		{
+			name:       "should inject an error with the configured status",
+			rule:       Rule{ErrorRate: 0.5, ErrorStatusCodes: []int{http.StatusServiceUnavailable}},
+			random:     0.1,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "should default injected errors to 500",
+			rule:       Rule{ErrorRate: 1},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "should not inject an error above the rate",
+			rule:       Rule{ErrorRate: 0.5},
+			random:     0.9,
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestInjector(Config{Routes: map[string]Rule{"servico-a": tt.rule}}, tt.random)
+
+			start := time.Now()
+			w, called := serve(i, "servico-a", httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if called != tt.wantCalled {
+				t.Errorf("handler called = %v, want %v", called, tt.wantCalled)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minElapsed {
+				t.Errorf("elapsed = %s, want at least %s", elapsed, tt.minElapsed)
+			}
+		})
+	}
+}
+
+func TestInjector_LatencyRespectsCancellation(t *testing.T) {
+	i := newTestInjector(Config{Routes: map[string]Rule{
+		"servico-a": {Latency: &Latency{Distribution: Fixed, Value: time.Minute}},
+	}}, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, called := serve(i, "servico-a", httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if called {
+		t.Error("expected the handler to be skipped for a cancelled request")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("elapsed = %s, expected the latency to stop on cancellation", elapsed)
+	}
+}
+
+func TestInjector_Abort(t *testing.T) {
+	i := newTestInjector(Config{Routes: map[string]Rule{"servico-a": {AbortRate: 1}}}, 0)
+
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want %v", r, http.ErrAbortHandler)
+		}
+	}()
+	serve(i, "servico-a", httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Error("expected the request to be aborted")
+}
+
+func TestLatency_Sample(t *testing.T) {
+	random := func() float64 { return 0.5 }
+	normal := func() float64 { return 1 }
+
+	tests := []struct {
+		name    string
+		latency *Latency
+		want    time.Duration
+	}{
+		{name: "fixed", latency: &Latency{Distribution: Fixed, Value: time.Second}, want: time.Second},
+		{name: "uniform", latency: &Latency{Distribution: Uniform, Min: time.Second, Max: 3 * time.Second}, want: 2 * time.Second},
+		{name: "normal", latency: &Latency{Distribution: Normal, Mean: time.Second, StdDev: 100 * time.Millisecond}, want: 1100 * time.Millisecond},
+		{name: "normal never negative", latency: &Latency{Distribution: Normal, Mean: -time.Second}, want: 0},
+		{name: "none", latency: nil, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.latency.Sample(random, normal); got != tt.want {
+				t.Errorf("Sample() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "chaos.yaml")
+	os.WriteFile(valid, []byte(`
+routes:
+  servico-a:
+    latency:
+      distribution: uniform
+      min: 100ms
+      max: 2s
+    error_rate: 0.1
+    error_status_codes: [500, 503]
+`), 0o644)
+	invalid := filepath.Join(dir, "invalid.yaml")
+	os.WriteFile(invalid, []byte(`
+routes:
+  servico-a:
+    error_rate: 2
+`), 0o644)
+
+	cfg, err := LoadConfig(valid)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	rule := cfg.Routes["servico-a"]
+	if rule.Latency.Max != 2*time.Second || rule.ErrorRate != 0.1 || len(rule.ErrorStatusCodes) != 2 {
+		t.Errorf("LoadConfig() rule = %+v", rule)
+	}
+
+	if _, err := LoadConfig(invalid); err == nil {
+		t.Error("expected an error for an invalid error_rate")
+	}
+	if cfg, err := LoadConfig(""); err != nil || len(cfg.Routes) != 0 {
+		t.Errorf("LoadConfig(\"\") = %+v, %v, want an empty config", cfg, err)
+	}
+}
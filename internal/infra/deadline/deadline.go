@@ -0,0 +1,96 @@
+package deadline
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Header carries the time the caller is still willing to wait for a response,
+// encoded like grpc-timeout: at most eight digits followed by a unit
+// (H hours, M minutes, S seconds, m milliseconds, u microseconds, n nanoseconds).
+const Header = "X-Request-Timeout"
+
+const maxValue = 99999999
+
+var units = []struct {
+	suffix byte
+	unit   time.Duration
+}{
+	{'n', time.Nanosecond},
+	{'u', time.Microsecond},
+	{'m', time.Millisecond},
+	{'S', time.Second},
+	{'M', time.Minute},
+	{'H', time.Hour},
+}
+
+// Encode formats d with the finest unit that fits in eight digits
+func Encode(d time.Duration) string {
+	if d <= 0 {
+		return "0n"
+	}
+	for _, u := range units {
+		value := (d + u.unit - 1) / u.unit
+		if value <= maxValue {
+			return strconv.FormatInt(int64(value), 10) + string(u.suffix)
+		}
+	}
+	return strconv.FormatInt(math.MaxInt64/int64(time.Hour), 10) + "H"
+}
+
+// Decode parses a value produced by Encode
+func Decode(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, fmt.Errorf("invalid timeout %q", s)
+	}
+	value, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid timeout %q", s)
+	}
+	for _, u := range units {
+		if u.suffix == s[len(s)-1] {
+			if value > math.MaxInt64/int64(u.unit) {
+				return 0, fmt.Errorf("timeout %q out of range", s)
+			}
+			return time.Duration(value) * u.unit, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid timeout unit in %q", s)
+}
+
+// Inject sets Header to the time left before the deadline of ctx, if any
+func Inject(ctx context.Context, header http.Header) {
+	if d, ok := ctx.Deadline(); ok {
+		header.Set(Header, Encode(time.Until(d)))
+	}
+}
+
+// Middleware bounds the request context by the deadline received in Header,
+// answering 504 right away when the caller has no time left
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(Header)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		timeout, err := Decode(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if timeout <= 0 {
+			http.Error(w, "deadline exceeded", http.StatusGatewayTimeout)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,102 @@
+package deadline
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+		want     string
+	}{
+		{name: "should encode sub-second timeouts in nanoseconds", duration: 1500 * time.Microsecond, want: "1500000n"},
+		{name: "should encode seconds in microseconds", duration: 30 * time.Second, want: "30000000u"},
+		{name: "should encode hours in milliseconds", duration: 2 * time.Hour, want: "7200000m"},
+		{name: "should encode expired deadlines as zero", duration: -time.Second, want: "0n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Encode(tt.duration)
+			if got != tt.want {
+				t.Errorf("Encode() = %q, want %q", got, tt.want)
+			}
+			decoded, err := Decode(got)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if tt.duration > 0 && decoded != tt.duration {
+				t.Errorf("Decode() = %s, want %s", decoded, tt.duration)
+			}
+		})
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	for _, value := range []string{"", "5", "10x", "-1S", "123456789S", "1.5S", "99999999H", "3000000H"} {
+		if _, err := Decode(value); err == nil {
+			t.Errorf("Decode(%q) expected error", value)
+		}
+	}
+}
+
+func TestInject(t *testing.T) {
+	header := http.Header{}
+	Inject(context.Background(), header)
+	if header.Get(Header) != "" {
+		t.Error("expected no header without deadline")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	Inject(ctx, header)
+	got, err := Decode(header.Get(Header))
+	if err != nil || got <= 0 || got > time.Second {
+		t.Errorf("Inject() header = %q, want at most 1s", header.Get(Header))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d, ok := r.Context().Deadline(); ok {
+			w.Header().Set("X-Remaining", time.Until(d).String())
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name         string
+		header       string
+		wantStatus   int
+		wantDeadline bool
+	}{
+		{name: "should pass requests without header through", wantStatus: http.StatusOK},
+		{name: "should bound the context by the received timeout", header: "500m", wantStatus: http.StatusOK, wantDeadline: true},
+		{name: "should answer 504 when no time is left", header: "0n", wantStatus: http.StatusGatewayTimeout},
+		{name: "should reject malformed timeouts", header: "soon", wantStatus: http.StatusBadRequest},
+		{name: "should reject timeouts that overflow", header: "99999999H", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(Header, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if (w.Header().Get("X-Remaining") != "") != tt.wantDeadline {
+				t.Errorf("deadline set = %v, want %v", w.Header().Get("X-Remaining") != "", tt.wantDeadline)
+			}
+		})
+	}
+}
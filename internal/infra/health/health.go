@@ -0,0 +1,202 @@
+// Package health exposes the liveness and readiness of the process
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses reported in the JSON breakdown
+const (
+	StatusOK           = "ok"
+	StatusFailing      = "failing"
+	StatusStarting     = "starting"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Default check settings
+const (
+	DefaultTimeout  = 2 * time.Second
+	DefaultCacheTTL = 10 * time.Second
+)
+
+// Check is a dependency probed by the readiness endpoint
+type Check struct {
+	Name string
+	// Run returns nil when the dependency is usable
+	Run func(ctx context.Context) error
+	// Timeout bounds a single run
+	Timeout time.Duration
+	// CacheTTL is how long a result is reused before running the check
+	// again, so probes do not hammer the dependencies
+	CacheTTL time.Duration
+	// Optional checks are reported without failing readiness
+	Optional bool
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Optional   bool      `json:"optional,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Report is the JSON body of the readiness endpoint
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+type registeredCheck struct {
+	Check
+	mu     sync.Mutex
+	result Result
+}
+
+// run returns the cached result while it is fresh, running the check
+// otherwise. Concurrent callers wait for a single run.
+func (c *registeredCheck) run(ctx context.Context, now func() time.Time) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.result.CheckedAt.IsZero() && now().Sub(c.result.CheckedAt) < c.CacheTTL {
+		return c.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	start := now()
+	err := c.Run(ctx)
+
+	c.result = Result{Status: StatusOK, Optional: c.Optional, CheckedAt: start}
+	c.result.DurationMs = float64(now().Sub(start).Microseconds()) / 1000
+	if err != nil {
+		c.result.Status = StatusFailing
+		c.result.Error = err.Error()
+	}
+	return c.result
+}
+
+// Readiness tells load balancers whether the process accepts new traffic.
+// It starts as not ready and is flipped once the listener is up, and back
+// to failing as the first step of a graceful shutdown. While ready, every
+// registered check must pass, except the optional ones.
+type Readiness struct {
+	ready    atomic.Bool
+	stopping atomic.Bool
+	mu       sync.RWMutex
+	checks   []*registeredCheck
+	now      func() time.Time
+}
+
+// NewReadiness creates a Readiness that is not ready yet
+func NewReadiness() *Readiness {
+	return &Readiness{now: time.Now}
+}
+
+// AddCheck registers a dependency check, filling in the default timeout and
+// cache TTL
+func (r *Readiness) AddCheck(c Check) {
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.CacheTTL <= 0 {
+		c.CacheTTL = DefaultCacheTTL
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, &registeredCheck{Check: c})
+}
+
+// Set marks the process as ready or not. Setting it back to false after it
+// was ready means the process is shutting down.
+func (r *Readiness) Set(ready bool) {
+	if !ready && r.ready.Load() {
+		r.stopping.Store(true)
+	}
+	r.ready.Store(ready)
+}
+
+// Ready reports whether the process accepts new traffic, without running
+// the checks
+func (r *Readiness) Ready() bool {
+	return r.ready.Load()
+}
+
+// Check runs the registered checks concurrently, reusing fresh cached
+// results, and reports the overall status
+func (r *Readiness) Check(ctx context.Context) Report {
+	switch {
+	case r.stopping.Load():
+		return Report{Status: StatusShuttingDown}
+	case !r.ready.Load():
+		return Report{Status: StatusStarting}
+	}
+
+	r.mu.RLock()
+	checks := append([]*registeredCheck(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, r.now)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	for i, c := range checks {
+		report.Checks[c.Name] = results[i]
+		if results[i].Status != StatusOK && !c.Optional {
+			report.Status = StatusFailing
+		}
+	}
+	return report
+}
+
+// Handler answers the JSON report, with 200 when ready and 503 otherwise
+func (r *Readiness) Handler(w http.ResponseWriter, req *http.Request) {
+	report := r.Check(req.Context())
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// Live answers 200 as long as the process can serve requests at all
+func Live(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+func writeJSON(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
+
+// TCP returns a check that succeeds when address accepts connections
+func TCP(address string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
@@ -0,0 +1,136 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadiness_Handler(t *testing.T) {
+	failing := func(context.Context) error { return errors.New("connection refused") }
+	passing := func(context.Context) error { return nil }
+
+	tests := []struct {
+		name       string
+		ready      []bool
+		checks     []Check
+		wantStatus int
+		wantReport string
+	}{
+		{name: "should fail before the server is ready", ready: []bool{false}, wantStatus: http.StatusServiceUnavailable, wantReport: StatusStarting},
+		{name: "should pass once ready without checks", ready: []bool{true}, wantStatus: http.StatusOK, wantReport: StatusOK},
+		{name: "should fail while shutting down", ready: []bool{true, false}, wantStatus: http.StatusServiceUnavailable, wantReport: StatusShuttingDown},
+		{
+			name:       "should pass when every check passes",
+			ready:      []bool{true},
+			checks:     []Check{{Name: "a", Run: passing}, {Name: "b", Run: passing}},
+			wantStatus: http.StatusOK,
+			wantReport: StatusOK,
+		},
+		{
+			name:       "should fail when a required check fails",
+			ready:      []bool{true},
+			checks:     []Check{{Name: "a", Run: passing}, {Name: "b", Run: failing}},
+			wantStatus: http.StatusServiceUnavailable,
+			wantReport: StatusFailing,
+		},
+		{
+			name:       "should ignore failing optional checks",
+			ready:      []bool{true},
+			checks:     []Check{{Name: "a", Run: passing}, {Name: "exporter", Run: failing, Optional: true}},
+			wantStatus: http.StatusOK,
+			wantReport: StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReadiness()
+			for _, c := range tt.checks {
+				r.AddCheck(c)
+			}
+			for _, ready := range tt.ready {
+				r.Set(ready)
+			}
+
+			w := httptest.NewRecorder()
+			r.Handler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var report Report
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatalf("failed to decode report: %v", err)
+			}
+			if report.Status != tt.wantReport {
+				t.Errorf("report status = %q, want %q", report.Status, tt.wantReport)
+			}
+			if tt.wantReport == StatusOK || tt.wantReport == StatusFailing {
+				if len(report.Checks) != len(tt.checks) {
+					t.Errorf("report has %d checks, want %d", len(report.Checks), len(tt.checks))
+				}
+			}
+		})
+	}
+}
+
+func TestReadiness_CachesAndTimesOut(t *testing.T) {
+	var runs atomic.Int32
+	now := time.Now()
+
+	r := NewReadiness()
+	r.now = func() time.Time { return now }
+	r.AddCheck(Check{
+		Name:     "slow",
+		Timeout:  20 * time.Millisecond,
+		CacheTTL: time.Minute,
+		Run: func(ctx context.Context) error {
+			runs.Add(1)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	r.Set(true)
+
+	start := time.Now()
+	report := r.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("check took %s, want it cut at its timeout", elapsed)
+	}
+	if report.Checks["slow"].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("check error = %q, want the timeout", report.Checks["slow"].Error)
+	}
+
+	r.Check(context.Background())
+	if got := runs.Load(); got != 1 {
+		t.Errorf("check ran %d times, want the cached result reused", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	r.Check(context.Background())
+	if got := runs.Load(); got != 2 {
+		t.Errorf("check ran %d times, want it run again after the TTL", got)
+	}
+}
+
+func TestTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+
+	if err := TCP(addr)(context.Background()); err != nil {
+		t.Errorf("TCP() error = %v with a listener", err)
+	}
+	listener.Close()
+	if err := TCP(addr)(context.Background()); err == nil {
+		t.Error("TCP() expected an error without a listener")
+	}
+}
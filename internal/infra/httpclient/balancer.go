@@ -0,0 +1,320 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Policy selects which instance serves the next attempt
+type Policy string
+
+const (
+	RoundRobin       Policy = "round_robin"
+	LeastOutstanding Policy = "least_outstanding"
+)
+
+// unhealthyThreshold is the number of consecutive failed health checks that
+// ejects an instance
+const unhealthyThreshold = 2
+
+// Instance is a single upstream endpoint with its own breaker and health state
+type Instance struct {
+	URL         string
+	breaker     *CircuitBreaker
+	outstanding atomic.Int64
+	healthy     atomic.Bool
+	failedProbe int
+}
+
+// Breaker returns the circuit breaker guarding the instance
+func (i *Instance) Breaker() *CircuitBreaker {
+	return i.breaker
+}
+
+// Healthy reports whether the instance passes its active health checks
+func (i *Instance) Healthy() bool {
+	return i.healthy.Load()
+}
+
+// Outstanding returns the number of in-flight requests to the instance
+func (i *Instance) Outstanding() int64 {
+	return i.outstanding.Load()
+}
+
+// Balancer spreads requests over the instances returned by a Resolver,
+// re-resolving them periodically and ejecting the ones failing health checks
+type Balancer struct {
+	cfg      Config
+	resolver Resolver
+	http     *http.Client
+
+	mu        sync.RWMutex
+	instances []*Instance
+	next      atomic.Uint64
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+func newBalancer(cfg Config, resolver Resolver, client *http.Client) *Balancer {
+	return &Balancer{
+		cfg:      cfg,
+		resolver: resolver,
+		http:     client,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Instances returns a snapshot of the known instances
+func (b *Balancer) Instances() []*Instance {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]*Instance(nil), b.instances...)
+}
+
+// Refresh resolves the instances again, keeping the state of the ones that
+// are still present
+func (b *Balancer) Refresh(ctx context.Context) error {
+	urls, err := b.resolver.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current := make(map[string]*Instance, len(b.instances))
+	for _, inst := range b.instances {
+		current[inst.URL] = inst
+	}
+
+	instances := make([]*Instance, 0, len(urls))
+	for _, u := range urls {
+		if inst, ok := current[u]; ok {
+			instances = append(instances, inst)
+			delete(current, u)
+			continue
+		}
+		instances = append(instances, b.newInstance(u))
+	}
+	for u := range current {
+		breakerStateGauge.DeleteLabelValues(b.cfg.Name, u)
+		instanceHealthyGauge.DeleteLabelValues(b.cfg.Name, u)
+	}
+	b.instances = instances
+	return nil
+}
+
+func (b *Balancer) newInstance(u string) *Instance {
+	name := b.cfg.Name
+	inst := &Instance{URL: u}
+	inst.breaker = NewCircuitBreaker(b.cfg.BreakerThreshold, b.cfg.BreakerCooldown, func(state BreakerState) {
+		breakerStateGauge.WithLabelValues(name, u).Set(float64(state))
+	})
+	inst.healthy.Store(true)
+	instanceHealthyGauge.WithLabelValues(name, u).Set(1)
+	return inst
+}
+
+// Pick returns the instance for the next attempt, acquiring its breaker.
+// Instances in tried are only reused once every other one has been tried,
+// and unhealthy instances are only used when no healthy one is left.
+func (b *Balancer) Pick(tried map[*Instance]bool) (*Instance, error) {
+	candidates := b.candidates(tried)
+	if len(candidates) == 0 {
+		return nil, ErrNoInstances
+	}
+
+	for _, inst := range candidates {
+		if inst.breaker.Allow() {
+			inst.outstanding.Add(1)
+			return inst, nil
+		}
+	}
+	return nil, ErrCircuitOpen
+}
+
+// Done releases an instance acquired with Pick
+func (b *Balancer) Done(inst *Instance) {
+	inst.outstanding.Add(-1)
+}
+
+// untried reports whether a healthy instance outside tried is left
+func (b *Balancer) untried(tried map[*Instance]bool) bool {
+	for _, inst := range b.Instances() {
+		if inst.Healthy() && !tried[inst] {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Balancer) candidates(tried map[*Instance]bool) []*Instance {
+	all := b.Instances()
+
+	filter := func(keep func(*Instance) bool) []*Instance {
+		var out []*Instance
+		for _, inst := range all {
+			if keep(inst) {
+				out = append(out, inst)
+			}
+		}
+		return out
+	}
+
+	candidates := filter(func(i *Instance) bool { return i.Healthy() && !tried[i] })
+	if len(candidates) == 0 {
+		candidates = filter(func(i *Instance) bool { return i.Healthy() })
+	}
+	if len(candidates) == 0 {
+		// every instance failed its health checks: fail open instead of
+		// refusing all traffic
+		candidates = all
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	switch b.cfg.Policy {
+	case LeastOutstanding:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Outstanding() < candidates[j].Outstanding()
+		})
+	default:
+		start := int(b.next.Add(1)-1) % len(candidates)
+		candidates = append(candidates[start:], candidates[:start]...)
+	}
+	return candidates
+}
+
+// Start launches the re-resolution and health check workers
+func (b *Balancer) Start() {
+	if b.cfg.ResolveInterval > 0 {
+		b.every(b.cfg.ResolveInterval, func(ctx context.Context) {
+			if err := b.Refresh(ctx); err != nil {
+				log.Printf("%s: failed to resolve instances: %v", b.cfg.Name, err)
+			}
+		})
+	}
+	if b.cfg.HealthCheckPath != "" {
+		b.every(b.cfg.HealthCheckInterval, b.checkHealth)
+	}
+}
+
+// Stop terminates the background workers
+func (b *Balancer) Stop() {
+	close(b.stop)
+	b.done.Wait()
+}
+
+func (b *Balancer) every(interval time.Duration, fn func(ctx context.Context)) {
+	b.done.Add(1)
+	go func() {
+		defer b.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.stop:
+				return
+			case <-ticker.C:
+				fn(context.Background())
+			}
+		}
+	}()
+}
+
+func (b *Balancer) checkHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, inst := range b.Instances() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.probe(ctx, inst)
+		}()
+	}
+	wg.Wait()
+}
+
+func (b *Balancer) probe(ctx context.Context, inst *Instance) {
+	ctx, cancel := context.WithTimeout(ctx, b.cfg.HealthCheckTimeout)
+	defer cancel()
+
+	ok := b.get(ctx, inst.URL, b.cfg.HealthCheckPath) == nil
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ok {
+		inst.failedProbe = 0
+	} else {
+		inst.failedProbe++
+	}
+	healthy := inst.failedProbe < unhealthyThreshold
+	if inst.healthy.Swap(healthy) != healthy {
+		log.Printf("%s: instance %s healthy=%v", b.cfg.Name, inst.URL, healthy)
+		value := 0.0
+		if healthy {
+			value = 1
+		}
+		instanceHealthyGauge.WithLabelValues(b.cfg.Name, inst.URL).Set(value)
+	}
+}
+
+// Ping succeeds when at least one instance answers 2xx on path, which
+// replaces the path of the instance URLs
+func (b *Balancer) Ping(ctx context.Context, path string) error {
+	instances := b.Instances()
+	if len(instances) == 0 {
+		return ErrNoInstances
+	}
+
+	var errs []error
+	for _, inst := range instances {
+		err := b.get(ctx, inst.URL, path)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", inst.URL, err))
+	}
+	return errors.Join(errs...)
+}
+
+// get requests path on an instance, failing unless it answers 2xx
+func (b *Balancer) get(ctx context.Context, base, path string) error {
+	target, err := healthCheckURL(base, path)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := b.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// healthCheckURL replaces the path of an instance base URL with path
+func healthCheckURL(base, path string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	u.Path = path
+	u.RawQuery = ""
+	return u.String(), nil
+}
@@ -0,0 +1,220 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestBalancer(t *testing.T, cfg Config, urls ...string) *Balancer {
+	t.Helper()
+	b := newBalancer(cfg.withDefaults(), StaticResolver(urls), http.DefaultClient)
+	if err := b.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	return b
+}
+
+func pickURL(t *testing.T, b *Balancer) string {
+	t.Helper()
+	inst, err := b.Pick(nil)
+	if err != nil {
+		t.Fatalf("Pick() error = %v", err)
+	}
+	return inst.URL
+}
+
+func TestBalancer_RoundRobin(t *testing.T) {
+	b := newTestBalancer(t, Config{Name: "rr"}, "http://a", "http://b", "http://c")
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		got = append(got, pickURL(t, b))
+	}
+
+	want := []string{"http://a", "http://b", "http://c", "http://a", "http://b", "http://c"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("picks = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestBalancer_LeastOutstanding(t *testing.T) {
+	b := newTestBalancer(t, Config{Name: "lor", Policy: LeastOutstanding}, "http://a", "http://b")
+
+	first, _ := b.Pick(nil)
+	second, _ := b.Pick(nil)
+	if first == second {
+		t.Fatalf("expected the second pick to avoid the busy instance %s", first.URL)
+	}
+
+	b.Done(first)
+	if got := pickURL(t, b); got != first.URL {
+		t.Errorf("Pick() = %s, want the idle instance %s", got, first.URL)
+	}
+}
+
+func TestBalancer_SkipsTriedAndUnhealthyInstances(t *testing.T) {
+	b := newTestBalancer(t, Config{Name: "skip"}, "http://a", "http://b", "http://c")
+	instances := b.Instances()
+	instances[1].healthy.Store(false)
+
+	inst, _ := b.Pick(map[*Instance]bool{instances[0]: true})
+	if inst != instances[2] {
+		t.Errorf("Pick() = %s, want %s", inst.URL, instances[2].URL)
+	}
+
+	instances[0].healthy.Store(false)
+	instances[2].healthy.Store(false)
+	if got := pickURL(t, b); got == "" {
+		t.Error("expected the balancer to fail open when every instance is unhealthy")
+	}
+}
+
+func TestBalancer_HealthChecksEjectAndRestoreInstances(t *testing.T) {
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	b := newTestBalancer(t, Config{Name: "health", HealthCheckPath: "/healthz"}, server.URL+"/weather/servico-b")
+	inst := b.Instances()[0]
+
+	b.checkHealth(context.Background())
+	if !inst.Healthy() {
+		t.Fatal("expected a single failed check to keep the instance")
+	}
+	b.checkHealth(context.Background())
+	if inst.Healthy() {
+		t.Fatal("expected consecutive failed checks to eject the instance")
+	}
+
+	healthy.Store(true)
+	b.checkHealth(context.Background())
+	if !inst.Healthy() {
+		t.Fatal("expected a passing check to restore the instance")
+	}
+}
+
+func TestBalancer_Ping(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	if err := newTestBalancer(t, Config{Name: "ping"}, down.URL+"/weather", up.URL+"/weather").Ping(context.Background(), "/readyz"); err != nil {
+		t.Errorf("Ping() error = %v, want success with one instance up", err)
+	}
+	if err := newTestBalancer(t, Config{Name: "ping"}, down.URL+"/weather").Ping(context.Background(), "/readyz"); err == nil {
+		t.Error("Ping() expected an error when every instance is down")
+	}
+}
+
+func TestBalancer_RefreshKeepsExistingInstances(t *testing.T) {
+	resolver := StaticResolver{"http://a", "http://b"}
+	b := newBalancer(Config{Name: "refresh"}.withDefaults(), &resolver, http.DefaultClient)
+	b.Refresh(context.Background())
+	before := b.Instances()
+
+	resolver = StaticResolver{"http://b", "http://c"}
+	b.Refresh(context.Background())
+	after := b.Instances()
+
+	if len(after) != 2 || after[0] != before[1] || after[1].URL != "http://c" {
+		t.Errorf("instances after refresh = %v", after)
+	}
+}
+
+func TestParseEndpoints(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        string
+		want        Resolver
+		expectError bool
+	}{
+		{
+			name: "should parse a single URL",
+			spec: "http://goapp2:8181/weather/servico-b",
+			want: StaticResolver{"http://goapp2:8181/weather/servico-b"},
+		},
+		{
+			name: "should parse a list of URLs",
+			spec: "http://a:8181/weather/servico-b/, http://b:8181/weather/servico-b",
+			want: StaticResolver{"http://a:8181/weather/servico-b", "http://b:8181/weather/servico-b"},
+		},
+		{
+			name: "should parse a DNS A endpoint",
+			spec: "dns://goapp2:8181/weather/servico-b",
+			want: &DNSResolver{Scheme: "http", Host: "goapp2", Port: "8181", Path: "/weather/servico-b"},
+		},
+		{
+			name: "should parse a DNS SRV endpoint over https",
+			spec: "dnssrv+https://_https._tcp.goapp2/weather/servico-b",
+			want: &DNSResolver{Scheme: "https", Host: "_https._tcp.goapp2", Path: "/weather/servico-b", SRV: true},
+		},
+		{
+			name:        "should reject an empty spec",
+			spec:        " ",
+			expectError: true,
+		},
+		{
+			name:        "should reject a URL without scheme",
+			spec:        "goapp2:8181",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEndpoints(tt.spec)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseEndpoints() error = %v, expectError %v", err, tt.expectError)
+			}
+			if err != nil {
+				return
+			}
+			if dns, ok := got.(*DNSResolver); ok {
+				dns.lookup = nil
+			}
+			if !equalResolvers(got, tt.want) {
+				t.Errorf("ParseEndpoints() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalResolvers(a, b Resolver) bool {
+	switch a := a.(type) {
+	case StaticResolver:
+		b, ok := b.(StaticResolver)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	case *DNSResolver:
+		b, ok := b.(*DNSResolver)
+		return ok && *a == *b
+	}
+	return false
+}
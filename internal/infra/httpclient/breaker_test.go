@@ -0,0 +1,58 @@
+package httpclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	var states []BreakerState
+	b := NewCircuitBreaker(2, time.Second, func(state BreakerState) {
+		states = append(states, state)
+	})
+	b.now = func() time.Time { return now }
+
+	b.Failure()
+	if !b.Allow() {
+		t.Fatal("expected breaker to stay closed below the threshold")
+	}
+
+	b.Failure()
+	if b.State() != StateOpen {
+		t.Fatalf("expected breaker to open, got %s", b.State())
+	}
+	if b.Allow() {
+		t.Fatal("expected open breaker to reject calls during cooldown")
+	}
+
+	now = now.Add(time.Second)
+	if !b.Allow() {
+		t.Fatal("expected breaker to let a probe through after cooldown")
+	}
+	if b.Allow() {
+		t.Fatal("expected half-open breaker to allow a single probe")
+	}
+
+	b.Failure()
+	if b.State() != StateOpen {
+		t.Fatalf("expected failed probe to reopen the breaker, got %s", b.State())
+	}
+
+	now = now.Add(time.Second)
+	b.Allow()
+	b.Success()
+	if b.State() != StateClosed {
+		t.Fatalf("expected successful probe to close the breaker, got %s", b.State())
+	}
+
+	want := []BreakerState{StateClosed, StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateClosed}
+	if len(states) != len(want) {
+		t.Fatalf("transitions = %v, want %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Errorf("transition %d = %s, want %s", i, states[i], want[i])
+		}
+	}
+}
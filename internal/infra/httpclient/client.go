@@ -0,0 +1,349 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/deadline"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/tlsconfig"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrCircuitOpen is returned when the circuit breaker of every instance
+	// rejects a call
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+	// ErrNoInstances is returned when the resolver returned no instance
+	ErrNoInstances = errors.New("no instances available")
+)
+
+// DefaultAttemptTimeout bounds each attempt when Config.AttemptTimeout is
+// zero; it matches the SERVICO_B_ATTEMPT_TIMEOUT default
+const DefaultAttemptTimeout = 5 * time.Second
+
+const tracerName = "github.com/samucadutra/lab-otel-goexpert/internal/infra/httpclient"
+
+const (
+	// instanceKey is the span attribute holding the instance chosen for an attempt
+	instanceKey = attribute.Key("http.client.instance")
+	// hedgeKey marks attempts sent as a hedge of a slow request
+	hedgeKey = attribute.Key("http.client.hedge")
+	// cancelledKey marks attempts cancelled because another one answered first
+	cancelledKey = attribute.Key("http.client.cancelled")
+)
+
+// Config holds the resilience settings of a Client. Zero values fall back to
+// the defaults below.
+type Config struct {
+	Name             string
+	AttemptTimeout   time.Duration
+	MaxAttempts      int
+	BackoffBase      time.Duration
+	BackoffMax       time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	Policy              Policy
+	ResolveInterval     time.Duration
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+
+	// HedgePercentile enables hedging when greater than zero: an attempt
+	// still unanswered after this percentile of the observed latencies
+	// (clamped to [HedgeMinDelay, HedgeMaxDelay]) is sent again to another
+	// instance. HedgeMaxDelay is used until enough latencies are observed.
+	HedgePercentile float64
+	HedgeMinDelay   time.Duration
+	HedgeMaxDelay   time.Duration
+
+	// TLS configures https instances, e.g. with a private CA bundle and a
+	// client certificate for mTLS; nil uses the defaults
+	TLS *tls.Config
+
+	// Header is sent with every attempt, e.g. credentials
+	Header http.Header
+}
+
+func (c Config) withDefaults() Config {
+	if c.Name == "" {
+		c.Name = "http-client"
+	}
+	if c.AttemptTimeout <= 0 {
+		c.AttemptTimeout = DefaultAttemptTimeout
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+	if c.BackoffBase <= 0 {
+		c.BackoffBase = 100 * time.Millisecond
+	}
+	if c.BackoffMax <= 0 {
+		c.BackoffMax = 2 * time.Second
+	}
+	if c.BreakerThreshold <= 0 {
+		c.BreakerThreshold = 5
+	}
+	if c.BreakerCooldown <= 0 {
+		c.BreakerCooldown = 10 * time.Second
+	}
+	if c.Policy == "" {
+		c.Policy = RoundRobin
+	}
+	if c.HealthCheckInterval <= 0 {
+		c.HealthCheckInterval = 10 * time.Second
+	}
+	if c.HealthCheckTimeout <= 0 {
+		c.HealthCheckTimeout = time.Second
+	}
+	if c.HedgeMinDelay <= 0 {
+		c.HedgeMinDelay = 50 * time.Millisecond
+	}
+	if c.HedgeMaxDelay < c.HedgeMinDelay {
+		c.HedgeMaxDelay = max(time.Second, c.HedgeMinDelay)
+	}
+	return c
+}
+
+// Client is an HTTP client with per-attempt timeouts, jittered exponential
+// retries for idempotent requests and a circuit breaker per instance. Requests
+// are balanced over the instances of a Resolver and every attempt is traced
+// as its own client span.
+type Client struct {
+	cfg       Config
+	http      *http.Client
+	balancer  *Balancer
+	latencies *latencyTracker
+	tracer    trace.Tracer
+}
+
+// New creates a Client for the instances returned by resolver. Start must be
+// called before the first request.
+func New(cfg Config, resolver Resolver) *Client {
+	cfg = cfg.withDefaults()
+	httpClient := &http.Client{}
+	if cfg.TLS != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = cfg.TLS
+		httpClient.Transport = transport
+	}
+	return &Client{
+		cfg:       cfg,
+		http:      httpClient,
+		balancer:  newBalancer(cfg, resolver, httpClient),
+		latencies: newLatencyTracker(latencySamples),
+		tracer:    otel.Tracer(tracerName),
+	}
+}
+
+// Start resolves the instances and launches the background workers that keep
+// them up to date and health checked
+func (c *Client) Start(ctx context.Context) error {
+	if err := c.balancer.Refresh(ctx); err != nil {
+		return err
+	}
+	c.balancer.Start()
+	return nil
+}
+
+// Close stops the background workers
+func (c *Client) Close() {
+	c.balancer.Stop()
+}
+
+// Balancer returns the balancer spreading requests over the instances
+func (c *Client) Balancer() *Balancer {
+	return c.balancer
+}
+
+// Get issues a GET request for path, relative to the base URL of an instance
+func (c *Client) Get(ctx context.Context, path string) (*http.Response, error) {
+	return c.Do(ctx, http.MethodGet, path, nil)
+}
+
+// Do sends the request, retrying idempotent methods on network errors and
+// 502/503/504 responses, preferably on another instance. A 503 with
+// Retry-After is returned as is. The returned
+// response body is fully buffered, so it stays readable after the
+// per-attempt timeout has been released.
+func (c *Client) Do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	tried := make(map[*Instance]bool)
+	for attempt := 1; ; attempt++ {
+		resp, err := c.attempt(ctx, attempt, tried, method, path, body)
+		if attempt >= c.cfg.MaxAttempts || !c.shouldRetry(ctx, method, resp, err) {
+			return resp, err
+		}
+		if err := sleep(ctx, c.backoff(attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends the request to the next instance, hedging it on another
+// instance when enabled and the primary is slower than the hedge delay
+func (c *Client) attempt(ctx context.Context, attempt int, tried map[*Instance]bool, method, path string, body []byte) (*http.Response, error) {
+	if c.cfg.HedgePercentile > 0 && isIdempotent(method) {
+		return c.hedged(ctx, attempt, tried, method, path, body)
+	}
+
+	inst, err := c.pick(ctx, tried)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, attempt, inst, false, method, path, body)
+}
+
+func (c *Client) pick(ctx context.Context, tried map[*Instance]bool) (*Instance, error) {
+	inst, err := c.balancer.Pick(tried)
+	if err != nil {
+		attemptsCounter.WithLabelValues(c.cfg.Name, "rejected").Inc()
+		trace.SpanFromContext(ctx).AddEvent(fmt.Sprintf("%s request rejected", c.cfg.Name),
+			trace.WithAttributes(attribute.String("error", err.Error())))
+		return nil, err
+	}
+	tried[inst] = true
+	return inst, nil
+}
+
+// send performs a single request against inst in its own client span and
+// releases the instance afterwards
+func (c *Client) send(ctx context.Context, attempt int, inst *Instance, hedge bool, method, path string, body []byte) (*http.Response, error) {
+	defer c.balancer.Done(inst)
+
+	ctx, span := c.tracer.Start(ctx, fmt.Sprintf("%s attempt", c.cfg.Name),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", method),
+			attribute.Int("http.request.resend_count", attempt-1),
+			instanceKey.String(inst.URL),
+			attribute.String("url.full", inst.URL+path),
+			hedgeKey.Bool(hedge),
+		))
+	defer span.End()
+	start := time.Now()
+
+	attemptCtx, cancel := context.WithTimeout(ctx, c.cfg.AttemptTimeout)
+	defer cancel()
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(attemptCtx, method, inst.URL+path, bodyReader)
+	if err != nil {
+		inst.breaker.Release()
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	for name, values := range c.cfg.Header {
+		req.Header[name] = values
+	}
+	otel.GetTextMapPropagator().Inject(attemptCtx, propagation.HeaderCarrier(req.Header))
+	deadline.Inject(attemptCtx, req.Header)
+
+	resp, err := c.http.Do(req)
+	if err == nil {
+		var data []byte
+		data, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// the caller gave up or a hedged request won, which says nothing
+			// about the upstream health
+			inst.breaker.Release()
+			if errors.Is(ctx.Err(), context.Canceled) {
+				attemptsCounter.WithLabelValues(c.cfg.Name, "cancelled").Inc()
+				span.SetAttributes(cancelledKey.Bool(true))
+				return nil, err
+			}
+		} else {
+			inst.breaker.Failure()
+		}
+		attemptsCounter.WithLabelValues(c.cfg.Name, "error").Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	span.SetAttributes(tlsconfig.PeerAttributes(resp.TLS)...)
+	if throttled(resp) {
+		// the upstream answered that it is out of quota, which retrying or
+		// opening the breaker would not help
+		inst.breaker.Success()
+		attemptsCounter.WithLabelValues(c.cfg.Name, "throttled").Inc()
+	} else if resp.StatusCode >= http.StatusInternalServerError {
+		inst.breaker.Failure()
+		attemptsCounter.WithLabelValues(c.cfg.Name, "server_error").Inc()
+		span.SetStatus(codes.Error, resp.Status)
+	} else {
+		inst.breaker.Success()
+		attemptsCounter.WithLabelValues(c.cfg.Name, "success").Inc()
+		c.latencies.Observe(time.Since(start))
+	}
+	return resp, nil
+}
+
+func (c *Client) shouldRetry(ctx context.Context, method string, resp *http.Response, err error) bool {
+	if ctx.Err() != nil || !isIdempotent(method) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrNoInstances) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	if throttled(resp) {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns a full-jitter exponential delay for the given retry number
+func (c *Client) backoff(retry int) time.Duration {
+	ceiling := c.cfg.BackoffBase << (retry - 1)
+	if ceiling <= 0 || ceiling > c.cfg.BackoffMax {
+		ceiling = c.cfg.BackoffMax
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// throttled reports whether resp is a 503 telling when to come back, as
+// servico-b answers while the WeatherAPI quota is exhausted
+func throttled(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != ""
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,281 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/deadline"
+)
+
+func testConfig() Config {
+	return Config{
+		Name:             "test",
+		AttemptTimeout:   50 * time.Millisecond,
+		MaxAttempts:      3,
+		BackoffBase:      time.Millisecond,
+		BackoffMax:       5 * time.Millisecond,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Minute,
+	}
+}
+
+func newTestClient(t *testing.T, cfg Config, urls ...string) *Client {
+	t.Helper()
+	client := New(cfg, StaticResolver(urls))
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestClient_Get(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     func(calls int32, w http.ResponseWriter)
+		wantStatus  int
+		wantBody    string
+		wantCalls   int32
+		expectError bool
+	}{
+		{
+			name: "should return the first successful response",
+			handler: func(calls int32, w http.ResponseWriter) {
+				w.Write([]byte("ok"))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+			wantCalls:  1,
+		},
+		{
+			name: "should retry on service unavailable",
+			handler: func(calls int32, w http.ResponseWriter) {
+				if calls < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte("recovered"))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "recovered",
+			wantCalls:  3,
+		},
+		{
+			name: "should not retry a service unavailable with retry-after",
+			handler: func(calls int32, w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantCalls:  1,
+		},
+		{
+			name: "should not retry on not found",
+			handler: func(calls int32, w http.ResponseWriter) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+			wantCalls:  1,
+		},
+		{
+			name: "should return the last response when attempts are exhausted",
+			handler: func(calls int32, w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			wantStatus: http.StatusBadGateway,
+			wantCalls:  3,
+		},
+		{
+			name: "should retry attempts that exceed the per-attempt timeout",
+			handler: func(calls int32, w http.ResponseWriter) {
+				if calls == 1 {
+					time.Sleep(200 * time.Millisecond)
+				}
+				w.Write([]byte("fast"))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "fast",
+			wantCalls:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.handler(atomic.AddInt32(&calls, 1), w)
+			}))
+			defer server.Close()
+
+			resp, err := newTestClient(t, testConfig(), server.URL).Get(context.Background(), "")
+			if (err != nil) != tt.expectError {
+				t.Fatalf("Get() error = %v, expectError %v", err, tt.expectError)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("Get() calls = %d, want %d", got, tt.wantCalls)
+			}
+			if err != nil {
+				return
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Get() status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.wantBody {
+				t.Errorf("Get() body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestClient_DoDoesNotRetryNonIdempotentMethods(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	resp, err := newTestClient(t, testConfig(), server.URL).Do(context.Background(), http.MethodPost, "", []byte("{}"))
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Do() status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if calls != 1 {
+		t.Errorf("Do() calls = %d, want 1", calls)
+	}
+}
+
+func TestClient_BreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.BreakerThreshold = 2
+	client := newTestClient(t, cfg, server.URL)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get(context.Background(), ""); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+	}
+
+	_, err := client.Get(context.Background(), "")
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Get() error = %v, want %v", err, ErrCircuitOpen)
+	}
+	if calls != 2 {
+		t.Errorf("server calls = %d, want 2", calls)
+	}
+	if state := client.Balancer().Instances()[0].Breaker().State(); state != StateOpen {
+		t.Errorf("breaker state = %s, want %s", state, StateOpen)
+	}
+}
+
+func TestClient_BreakerIgnoresRetryAfter(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.BreakerThreshold = 2
+	client := newTestClient(t, cfg, server.URL)
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(context.Background(), "")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "60" {
+			t.Fatalf("Get() = %d Retry-After %q, want 503 with the header", resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+	}
+	if calls != 3 {
+		t.Errorf("server calls = %d, want 3", calls)
+	}
+	if state := client.Balancer().Instances()[0].Breaker().State(); state != StateClosed {
+		t.Errorf("breaker state = %s, want %s", state, StateClosed)
+	}
+}
+
+func TestClient_RetriesOnAnotherInstance(t *testing.T) {
+	var badCalls, goodCalls int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&badCalls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&goodCalls, 1)
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer good.Close()
+
+	client := newTestClient(t, testConfig(), bad.URL, good.URL)
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(context.Background(), "/12345678")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || string(body) != "/12345678" {
+			t.Fatalf("Get() = %d %q, want 200 %q", resp.StatusCode, body, "/12345678")
+		}
+	}
+	if goodCalls != 4 {
+		t.Errorf("good instance calls = %d, want 4", goodCalls)
+	}
+	if badCalls == 0 {
+		t.Error("expected the bad instance to receive traffic")
+	}
+}
+
+func TestClient_PropagatesDeadline(t *testing.T) {
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(deadline.Header)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err := newTestClient(t, testConfig(), server.URL).Get(ctx, ""); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	remaining, err := deadline.Decode(header)
+	if err != nil {
+		t.Fatalf("deadline header %q: %v", header, err)
+	}
+	if remaining <= 0 || remaining > 30*time.Millisecond {
+		t.Errorf("remaining = %s, want within the caller deadline", remaining)
+	}
+}
+
+func TestConfig_DefaultsMatchSettings(t *testing.T) {
+	settings := configs.Default().ServicoB
+	got := Config{}.withDefaults()
+
+	if got.AttemptTimeout != settings.AttemptTimeout || got.MaxAttempts != settings.MaxAttempts ||
+		got.BackoffBase != settings.BackoffBase || got.BackoffMax != settings.BackoffMax ||
+		got.BreakerThreshold != settings.BreakerThreshold || got.BreakerCooldown != settings.BreakerCooldown {
+		t.Errorf("client defaults %+v differ from the SERVICO_B_* defaults %+v", got, settings)
+	}
+}
@@ -0,0 +1,136 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// latencySamples is the size of the window used to compute hedge delays
+	latencySamples = 512
+	// minLatencySamples is the number of samples needed before the observed
+	// percentile is trusted over HedgeMaxDelay
+	minLatencySamples = 20
+)
+
+// latencyTracker keeps a sliding window of successful request latencies
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func newLatencyTracker(size int) *latencyTracker {
+	return &latencyTracker{samples: make([]time.Duration, 0, size)}
+}
+
+// Observe records the latency of a successful request
+func (t *latencyTracker) Observe(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.samples) < cap(t.samples) {
+		t.samples = append(t.samples, d)
+		return
+	}
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % len(t.samples)
+}
+
+// Percentile returns the p-th percentile (0 < p <= 1) of the window, or
+// false when too few samples were observed
+func (t *latencyTracker) Percentile(p float64) (time.Duration, bool) {
+	t.mu.Lock()
+	sorted := slices.Clone(t.samples)
+	t.mu.Unlock()
+
+	if len(sorted) < minLatencySamples {
+		return 0, false
+	}
+	slices.Sort(sorted)
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	idx = min(max(idx, 0), len(sorted)-1)
+	return sorted[idx], true
+}
+
+// hedgeDelay returns how long to wait for the primary request before hedging
+func (c *Client) hedgeDelay() time.Duration {
+	delay, ok := c.latencies.Percentile(c.cfg.HedgePercentile)
+	if !ok {
+		return c.cfg.HedgeMaxDelay
+	}
+	return min(max(delay, c.cfg.HedgeMinDelay), c.cfg.HedgeMaxDelay)
+}
+
+type legResult struct {
+	resp  *http.Response
+	err   error
+	hedge bool
+}
+
+// hedged sends the request to a primary instance and, if it has not answered
+// within the hedge delay, to a second instance as well. The first successful
+// response wins and the other request is cancelled.
+func (c *Client) hedged(ctx context.Context, attempt int, tried map[*Instance]bool, method, path string, body []byte) (*http.Response, error) {
+	primary, err := c.pick(ctx, tried)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(chan legResult, 2)
+	var cancels []context.CancelFunc
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+	launch := func(inst *Instance, hedge bool) {
+		legCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := c.send(legCtx, attempt, inst, hedge, method, path, body)
+			results <- legResult{resp: resp, err: err, hedge: hedge}
+		}()
+	}
+	launch(primary, false)
+
+	timer := time.NewTimer(c.hedgeDelay())
+	defer timer.Stop()
+
+	var last legResult
+	for received := 0; received < len(cancels); {
+		select {
+		case <-timer.C:
+			// hedging on an instance already tried, e.g. the only one, would
+			// only double the load on it
+			if !c.balancer.untried(tried) {
+				continue
+			}
+			inst, err := c.pick(ctx, tried)
+			if err != nil {
+				continue
+			}
+			hedgedCounter.WithLabelValues(c.cfg.Name).Inc()
+			trace.SpanFromContext(ctx).AddEvent(fmt.Sprintf("%s request hedged", c.cfg.Name),
+				trace.WithAttributes(instanceKey.String(inst.URL)))
+			launch(inst, true)
+		case res := <-results:
+			received++
+			if res.err == nil && (res.resp.StatusCode < http.StatusInternalServerError || throttled(res.resp)) {
+				if res.hedge {
+					hedgeWinsCounter.WithLabelValues(c.cfg.Name).Inc()
+				}
+				trace.SpanFromContext(ctx).SetAttributes(hedgeKey.Bool(len(cancels) > 1))
+				return res.resp, nil
+			}
+			last = res
+		}
+	}
+	return last.resp, last.err
+}
@@ -0,0 +1,123 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLatencyTracker_Percentile(t *testing.T) {
+	tracker := newLatencyTracker(100)
+	if _, ok := tracker.Percentile(0.9); ok {
+		t.Fatal("expected no percentile without samples")
+	}
+
+	for i := 1; i <= 100; i++ {
+		tracker.Observe(time.Duration(i) * time.Millisecond)
+	}
+	if got, _ := tracker.Percentile(0.9); got != 90*time.Millisecond {
+		t.Errorf("Percentile(0.9) = %s, want 90ms", got)
+	}
+
+	// the window slides: the oldest samples are replaced
+	for i := 0; i < 100; i++ {
+		tracker.Observe(time.Second)
+	}
+	if got, _ := tracker.Percentile(0.5); got != time.Second {
+		t.Errorf("Percentile(0.5) = %s, want 1s", got)
+	}
+}
+
+func TestClient_HedgesSlowRequests(t *testing.T) {
+	var slowCancelled atomic.Bool
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+			w.Write([]byte("slow"))
+		case <-r.Context().Done():
+			slowCancelled.Store(true)
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	cfg := testConfig()
+	cfg.AttemptTimeout = 2 * time.Second
+	cfg.HedgePercentile = 0.95
+	cfg.HedgeMinDelay = 10 * time.Millisecond
+	cfg.HedgeMaxDelay = 20 * time.Millisecond
+	client := newTestClient(t, cfg, slow.URL, fast.URL)
+
+	start := time.Now()
+	resp, err := client.Get(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "fast" {
+		t.Errorf("Get() body = %q, want %q", body, "fast")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Get() took %s, expected the hedge to answer first", elapsed)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !slowCancelled.Load() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !slowCancelled.Load() {
+		t.Error("expected the losing request to be cancelled")
+	}
+}
+
+func TestClient_DoesNotHedgeFastRequests(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.HedgePercentile = 0.95
+	cfg.HedgeMaxDelay = time.Second
+	client := newTestClient(t, cfg, server.URL)
+
+	if _, err := client.Get(context.Background(), ""); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("server calls = %d, want 1", calls)
+	}
+}
+
+func TestClient_DoesNotHedgeOnTheSameInstance(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("slow"))
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.AttemptTimeout = time.Second
+	cfg.HedgePercentile = 0.95
+	cfg.HedgeMinDelay = 10 * time.Millisecond
+	cfg.HedgeMaxDelay = 20 * time.Millisecond
+	client := newTestClient(t, cfg, server.URL)
+
+	if _, err := client.Get(context.Background(), ""); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("server calls = %d, want 1", got)
+	}
+}
@@ -0,0 +1,33 @@
+package httpclient
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	breakerStateGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_client_circuit_breaker_state",
+		Help: "Circuit breaker state per client instance (0 closed, 1 half-open, 2 open)",
+	}, []string{"client", "instance"})
+
+	instanceHealthyGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_client_instance_healthy",
+		Help: "Whether a client instance passes its active health checks",
+	}, []string{"client", "instance"})
+
+	attemptsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_attempts_total",
+		Help: "Outbound attempts per client and outcome",
+	}, []string{"client", "outcome"})
+
+	hedgedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_hedged_requests_total",
+		Help: "Requests hedged on a second instance per client",
+	}, []string{"client"})
+
+	hedgeWinsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_hedge_wins_total",
+		Help: "Hedged requests answered first by the hedge per client",
+	}, []string{"client"})
+)
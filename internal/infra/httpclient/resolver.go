@@ -0,0 +1,137 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Resolver returns the base URLs of the instances behind a client
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// StaticResolver always resolves to the same list of base URLs
+type StaticResolver []string
+
+func (r StaticResolver) Resolve(context.Context) ([]string, error) {
+	return r, nil
+}
+
+// DNSResolver resolves a host name to one base URL per address. With SRV set,
+// Host is looked up as an SRV record (e.g. _http._tcp.goapp2) and the port of
+// each target is taken from the record instead of Port.
+type DNSResolver struct {
+	Scheme string
+	Host   string
+	Port   string
+	Path   string
+	SRV    bool
+	lookup *net.Resolver
+}
+
+func (r *DNSResolver) Resolve(ctx context.Context) ([]string, error) {
+	if r.SRV {
+		_, records, err := r.lookup.LookupSRV(ctx, "", "", r.Host)
+		if err != nil {
+			return nil, fmt.Errorf("resolving SRV %s: %w", r.Host, err)
+		}
+		urls := make([]string, 0, len(records))
+		for _, srv := range records {
+			host := strings.TrimSuffix(srv.Target, ".")
+			urls = append(urls, r.url(net.JoinHostPort(host, strconv.Itoa(int(srv.Port)))))
+		}
+		return urls, nil
+	}
+
+	addrs, err := r.lookup.LookupHost(ctx, r.Host)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", r.Host, err)
+	}
+	urls := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		urls = append(urls, r.url(net.JoinHostPort(addr, r.Port)))
+	}
+	return urls, nil
+}
+
+func (r *DNSResolver) url(hostPort string) string {
+	return r.Scheme + "://" + hostPort + r.Path
+}
+
+// ParseEndpoints builds a Resolver from an endpoint spec. The spec is either a
+// comma separated list of base URLs, or a single discovery URL:
+//
+//	dns://goapp2:8181/weather/servico-b           A/AAAA records, http
+//	dns+https://goapp2:8443/weather/servico-b     A/AAAA records, https
+//	dnssrv://_http._tcp.goapp2/weather/servico-b  SRV records, http
+func ParseEndpoints(spec string) (Resolver, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("no endpoints configured")
+	}
+
+	if discovery, _, _ := strings.Cut(spec, "://"); strings.HasPrefix(discovery, "dns") {
+		return parseDNSEndpoint(spec)
+	}
+
+	var urls StaticResolver
+	for _, endpoint := range strings.Split(spec, ",") {
+		endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+		if endpoint == "" {
+			continue
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid endpoint %q", endpoint)
+		}
+		urls = append(urls, endpoint)
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no endpoints configured")
+	}
+	return urls, nil
+}
+
+func parseDNSEndpoint(spec string) (Resolver, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", spec, err)
+	}
+
+	discovery, scheme, found := strings.Cut(u.Scheme, "+")
+	if !found {
+		scheme = "http"
+	}
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("invalid endpoint %q: unsupported scheme %q", spec, scheme)
+	}
+
+	r := &DNSResolver{
+		Scheme: scheme,
+		Host:   u.Hostname(),
+		Port:   u.Port(),
+		Path:   strings.TrimRight(u.Path, "/"),
+		lookup: net.DefaultResolver,
+	}
+	switch discovery {
+	case "dns":
+		if r.Port == "" {
+			r.Port = "80"
+			if scheme == "https" {
+				r.Port = "443"
+			}
+		}
+	case "dnssrv":
+		r.SRV = true
+	default:
+		return nil, fmt.Errorf("invalid endpoint %q: unsupported discovery %q", spec, discovery)
+	}
+	if r.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q: missing host", spec)
+	}
+	return r, nil
+}
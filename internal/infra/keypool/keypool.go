@@ -0,0 +1,202 @@
+// Package keypool rotates through a pool of upstream API keys, setting aside
+// the keys the upstream rejects
+package keypool
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons a key is set aside
+const (
+	ReasonUnauthorized = "unauthorized"
+	ReasonForbidden    = "forbidden"
+	ReasonQuota        = "quota"
+)
+
+// DefaultCooldown is how long a rejected key is set aside when the pool does
+// not set one; keys over their quota wait for the next month instead
+const DefaultCooldown = 15 * time.Minute
+
+// ErrNoKeys is returned by a pool without keys
+var ErrNoKeys = errors.New("no API key configured")
+
+// Key is an API key and the fingerprint identifying it in metrics and logs
+type Key struct {
+	Value       string
+	Fingerprint string
+}
+
+// Fingerprint identifies a key without revealing it: the first 8 bytes of
+// its SHA-256, in hex
+func Fingerprint(value string) string {
+	digest := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(digest[:8])
+}
+
+// UnavailableError is returned when every key of the pool is set aside
+type UnavailableError struct {
+	Name string
+	// RetryAfter is how long until the first key is usable again
+	RetryAfter time.Duration
+	// Quota is set when every key was set aside for its quota
+	Quota bool
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("no usable %s API key, retry in %s", e.Name, e.RetryAfter.Round(time.Second))
+}
+
+type entry struct {
+	Key
+	disabledUntil time.Time
+	reason        string
+}
+
+// Pool hands out the current key until the upstream rejects it, then moves
+// on to the next usable one. A nil Pool has no keys.
+type Pool struct {
+	name     string
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	keys    []*entry
+	current int
+}
+
+// New creates a pool named name from values, skipping blanks and duplicates
+func New(name string, values []string, cooldown time.Duration) *Pool {
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	p := &Pool{name: name, cooldown: cooldown, now: time.Now}
+	seen := make(map[string]bool)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		p.keys = append(p.keys, &entry{Key: Key{Value: value, Fingerprint: Fingerprint(value)}})
+		availableGauge.WithLabelValues(name, Fingerprint(value)).Set(1)
+	}
+	return p
+}
+
+// ReadFile reads one key per line, skipping blank lines and # comments, as
+// in a mounted secret
+func ReadFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+	defer file.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			keys = append(keys, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Len returns the number of keys in the pool
+func (p *Pool) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.keys)
+}
+
+// Fingerprints returns the fingerprints of the keys, in rotation order
+func (p *Pool) Fingerprints() []string {
+	if p == nil {
+		return nil
+	}
+	fingerprints := make([]string, len(p.keys))
+	for i, k := range p.keys {
+		fingerprints[i] = k.Fingerprint
+	}
+	return fingerprints
+}
+
+// Get returns the current key, moving to the next usable one when it is set
+// aside. It returns an UnavailableError when no key is usable.
+func (p *Pool) Get() (Key, error) {
+	if p.Len() == 0 {
+		return Key{}, ErrNoKeys
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	soonest := time.Time{}
+	quotaOnly := true
+	for i := range p.keys {
+		index := (p.current + i) % len(p.keys)
+		k := p.keys[index]
+		if !now.Before(k.disabledUntil) {
+			if !k.disabledUntil.IsZero() {
+				k.disabledUntil, k.reason = time.Time{}, ""
+				availableGauge.WithLabelValues(p.name, k.Fingerprint).Set(1)
+			}
+			p.current = index
+			return k.Key, nil
+		}
+		if soonest.IsZero() || k.disabledUntil.Before(soonest) {
+			soonest = k.disabledUntil
+		}
+		quotaOnly = quotaOnly && k.reason == ReasonQuota
+	}
+	return Key{}, &UnavailableError{Name: p.name, RetryAfter: soonest.Sub(now), Quota: quotaOnly}
+}
+
+// Record counts a request sent with key
+func (p *Pool) Record(key Key) {
+	if p == nil {
+		return
+	}
+	requestsCounter.WithLabelValues(p.name, key.Fingerprint).Inc()
+}
+
+// Reject sets key aside for reason: until the next month (UTC) for quota
+// errors and for the cooldown otherwise
+func (p *Pool) Reject(key Key, reason string) {
+	if p == nil {
+		return
+	}
+	rejectionsCounter.WithLabelValues(p.name, key.Fingerprint, reason).Inc()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	until := now.Add(p.cooldown)
+	if reason == ReasonQuota {
+		utc := now.UTC()
+		until = time.Date(utc.Year(), utc.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	for i, k := range p.keys {
+		if k.Value != key.Value {
+			continue
+		}
+		k.disabledUntil, k.reason = until, reason
+		availableGauge.WithLabelValues(p.name, k.Fingerprint).Set(0)
+		if i == p.current {
+			p.current = (i + 1) % len(p.keys)
+		}
+	}
+}
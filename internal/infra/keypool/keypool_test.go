@@ -0,0 +1,145 @@
+package keypool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestPool(values []string, now *time.Time) *Pool {
+	p := New("test", values, time.Minute)
+	p.now = func() time.Time { return *now }
+	return p
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   int
+	}{
+		{name: "should keep every key", values: []string{"a", "b"}, want: 2},
+		{name: "should skip blanks and duplicates", values: []string{"a", " ", "a", " b "}, want: 2},
+		{name: "should accept no keys", values: nil, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New("test", tt.values, 0).Len(); got != tt.want {
+				t.Errorf("Len() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte("# primary\nkey-a\n\n  key-b  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := []string{"key-a", "key-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadFile() = %v, want %v", got, want)
+	}
+
+	if _, err := ReadFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("ReadFile() of a missing file should fail")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	got := Fingerprint("secret")
+	if len(got) != 16 || got == "secret" {
+		t.Errorf("Fingerprint() = %q, want 16 hex characters", got)
+	}
+	if Fingerprint("secret") != got || Fingerprint("other") == got {
+		t.Error("Fingerprint() should be stable and distinct per key")
+	}
+}
+
+func TestPool_Rotation(t *testing.T) {
+	now := time.Date(2025, 5, 20, 12, 0, 0, 0, time.UTC)
+	p := newTestPool([]string{"a", "b"}, &now)
+
+	get := func() string {
+		t.Helper()
+		key, err := p.Get()
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		return key.Value
+	}
+
+	if got := get(); got != "a" {
+		t.Fatalf("Get() = %q, want the first key", got)
+	}
+	if got := get(); got != "a" {
+		t.Fatalf("Get() = %q, want to stay on the first key", got)
+	}
+
+	p.Reject(Key{Value: "a"}, ReasonUnauthorized)
+	if got := get(); got != "b" {
+		t.Fatalf("Get() after a rejection = %q, want the second key", got)
+	}
+
+	p.Reject(Key{Value: "b"}, ReasonForbidden)
+	_, err := p.Get()
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("Get() error = %v, want UnavailableError", err)
+	}
+	if unavailable.Quota || unavailable.RetryAfter != time.Minute {
+		t.Errorf("UnavailableError = %+v, want a one minute wait not caused by the quota", unavailable)
+	}
+
+	now = now.Add(time.Minute)
+	if got := get(); got != "a" {
+		t.Errorf("Get() after the cooldown = %q, want the first key back", got)
+	}
+}
+
+func TestPool_Quota(t *testing.T) {
+	now := time.Date(2025, 5, 20, 12, 0, 0, 0, time.UTC)
+	p := newTestPool([]string{"a", "b"}, &now)
+
+	p.Reject(Key{Value: "a"}, ReasonQuota)
+	p.Reject(Key{Value: "b"}, ReasonQuota)
+
+	_, err := p.Get()
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) || !unavailable.Quota {
+		t.Fatalf("Get() error = %v, want an UnavailableError caused by the quota", err)
+	}
+	reset := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	if unavailable.RetryAfter != reset.Sub(now) {
+		t.Errorf("RetryAfter = %s, want until the next month", unavailable.RetryAfter)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := p.Get(); err == nil {
+		t.Error("Get() should not return a key over its quota before the next month")
+	}
+	now = reset
+	if _, err := p.Get(); err != nil {
+		t.Errorf("Get() in the next month error = %v", err)
+	}
+}
+
+func TestPool_Nil(t *testing.T) {
+	var p *Pool
+	if _, err := p.Get(); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("Get() error = %v, want ErrNoKeys", err)
+	}
+	p.Record(Key{})
+	p.Reject(Key{}, ReasonQuota)
+	if p.Len() != 0 || p.Fingerprints() != nil {
+		t.Error("a nil pool should have no keys")
+	}
+}
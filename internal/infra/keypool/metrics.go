@@ -0,0 +1,24 @@
+package keypool
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// keys are labelled by fingerprint, never by value
+var (
+	requestsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_api_key_requests_total",
+		Help: "Requests sent to the upstream per API key fingerprint",
+	}, []string{"upstream", "key"})
+
+	rejectionsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_api_key_rejections_total",
+		Help: "API keys set aside after an upstream rejection per fingerprint and reason",
+	}, []string{"upstream", "key", "reason"})
+
+	availableGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "upstream_api_key_available",
+		Help: "Whether an API key is in rotation (1) or set aside (0) per fingerprint",
+	}, []string{"upstream", "key"})
+)
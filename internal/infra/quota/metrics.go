@@ -0,0 +1,33 @@
+package quota
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	usedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "upstream_quota_used",
+		Help: "Requests sent to the upstream this month",
+	}, []string{"upstream"})
+
+	budgetGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "upstream_quota_budget",
+		Help: "Monthly request budget of the upstream",
+	}, []string{"upstream"})
+
+	remainingGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "upstream_quota_remaining",
+		Help: "Requests left in the monthly budget of the upstream",
+	}, []string{"upstream"})
+
+	rejectedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_quota_rejected_total",
+		Help: "Requests refused before reaching the upstream per reason",
+	}, []string{"upstream", "reason"})
+
+	upstreamThrottledCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_throttled_total",
+		Help: "429 answers received from the upstream",
+	}, []string{"upstream"})
+)
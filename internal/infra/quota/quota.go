@@ -0,0 +1,319 @@
+// Package quota guards a paid upstream API with a request rate and a monthly
+// request budget
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Reasons a request is refused before reaching the upstream
+const (
+	ReasonRate     = "rate_limit"
+	ReasonBudget   = "monthly_budget"
+	ReasonUpstream = "upstream_throttled"
+	ReasonKeys     = "no_usable_key"
+)
+
+// saveInterval bounds how often the usage is written to the state file
+const saveInterval = 10 * time.Second
+
+// ExhaustedError is returned when a request cannot be sent to the upstream
+type ExhaustedError struct {
+	Name   string
+	Reason string
+	// RetryAfter is how long until a request may be accepted again
+	RetryAfter time.Duration
+}
+
+func (e *ExhaustedError) Error() string {
+	switch e.Reason {
+	case ReasonBudget:
+		return fmt.Sprintf("%s quota exhausted: monthly budget used, resets in %s", e.Name, e.RetryAfter.Round(time.Minute))
+	case ReasonUpstream:
+		return fmt.Sprintf("%s quota exhausted: throttled by the upstream, retry in %s", e.Name, e.RetryAfter.Round(time.Second))
+	case ReasonKeys:
+		return fmt.Sprintf("%s quota exhausted: every API key was rejected, retry in %s", e.Name, e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("%s quota exhausted: rate limit reached, retry in %s", e.Name, e.RetryAfter.Round(time.Millisecond))
+}
+
+// RetryAfterSeconds formats RetryAfter for the Retry-After header
+func (e *ExhaustedError) RetryAfterSeconds() string {
+	return strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// Config sets the limits of an upstream; zero values disable a limit
+type Config struct {
+	// Name labels the metrics and errors
+	Name string
+	// RPS is the sustained request rate and Burst the requests allowed at
+	// once, defaulting to RPS rounded up
+	RPS   float64
+	Burst int
+	// MonthlyBudget is the number of requests allowed per calendar month
+	// (UTC)
+	MonthlyBudget int64
+	// StateFile keeps the monthly usage across restarts
+	StateFile string
+}
+
+// state is the usage persisted in the state file
+type state struct {
+	Month string `json:"month"`
+	Used  int64  `json:"used"`
+}
+
+// Limiter spaces the requests to an upstream and counts them against the
+// monthly budget. A nil Limiter allows everything.
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu           sync.Mutex
+	tokens       float64
+	last         time.Time
+	month        string
+	used         int64
+	blockedUntil time.Time
+	// exhaustedUntil is set when the upstream reports the quota over
+	exhaustedUntil time.Time
+	lastSave       time.Time
+	unsavedChange  bool
+}
+
+// New creates a Limiter for cfg, loading the usage from its state file
+func New(cfg Config) (*Limiter, error) {
+	if cfg.RPS < 0 || cfg.Burst < 0 || cfg.MonthlyBudget < 0 {
+		return nil, errors.New("quota limits must not be negative")
+	}
+	if cfg.RPS > 0 && cfg.Burst == 0 {
+		cfg.Burst = max(int(math.Ceil(cfg.RPS)), 1)
+	}
+
+	l := &Limiter{cfg: cfg, now: time.Now}
+	now := l.now()
+	l.tokens = float64(cfg.Burst)
+	l.last = now
+	l.month = monthOf(now)
+	if cfg.StateFile != "" {
+		if err := l.load(); err != nil {
+			return nil, err
+		}
+	}
+	l.updateMetrics()
+	return l, nil
+}
+
+func monthOf(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// nextMonth returns the start of the month after t, in UTC
+func nextMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (l *Limiter) load() error {
+	data, err := os.ReadFile(l.cfg.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read quota state: %w", err)
+	}
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("failed to parse quota state: %w", err)
+	}
+	if s.Month == l.month {
+		l.used = s.Used
+	}
+	return nil
+}
+
+// save writes the usage to the state file; the caller holds mu
+func (l *Limiter) save() error {
+	if l.cfg.StateFile == "" || !l.unsavedChange {
+		return nil
+	}
+	data, _ := json.Marshal(state{Month: l.month, Used: l.used})
+	tmp := l.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write quota state: %w", err)
+	}
+	if err := os.Rename(tmp, l.cfg.StateFile); err != nil {
+		return fmt.Errorf("failed to write quota state: %w", err)
+	}
+	l.unsavedChange = false
+	return nil
+}
+
+// Close writes the pending usage to the state file
+func (l *Limiter) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.save()
+}
+
+// Acquire reserves a request to the upstream. It waits for the rate limit
+// when the wait fits in the deadline of ctx, and returns an ExhaustedError
+// when the request cannot be sent.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	wait, err := l.reserve(ctx)
+	if err != nil {
+		rejectedCounter.WithLabelValues(l.cfg.Name, err.Reason).Inc()
+		return err
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// the reservation is spent; the upstream was not called, so the
+		// budget is given back
+		l.release()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve takes a token and a unit of budget, returning how long to wait for
+// the token
+func (l *Limiter) reserve(ctx context.Context) (time.Duration, *ExhaustedError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if month := monthOf(now); month != l.month {
+		l.month, l.used, l.unsavedChange = month, 0, true
+	}
+	if now.Before(l.blockedUntil) {
+		return 0, &ExhaustedError{Name: l.cfg.Name, Reason: ReasonUpstream, RetryAfter: l.blockedUntil.Sub(now)}
+	}
+	if now.Before(l.exhaustedUntil) || l.cfg.MonthlyBudget > 0 && l.used >= l.cfg.MonthlyBudget {
+		return 0, &ExhaustedError{Name: l.cfg.Name, Reason: ReasonBudget, RetryAfter: nextMonth(now).Sub(now)}
+	}
+
+	var wait time.Duration
+	if l.cfg.RPS > 0 {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.cfg.RPS, float64(l.cfg.Burst))
+		l.last = now
+		if l.tokens < 1 {
+			wait = time.Duration((1 - l.tokens) / l.cfg.RPS * float64(time.Second))
+			if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+				return 0, &ExhaustedError{Name: l.cfg.Name, Reason: ReasonRate, RetryAfter: wait}
+			}
+		}
+		// the token may go negative, queueing the next callers behind this one
+		l.tokens--
+	}
+
+	l.used++
+	l.unsavedChange = true
+	if now.Sub(l.lastSave) >= saveInterval {
+		l.lastSave = now
+		// a failed save is retried on the next interval or on Close
+		l.save()
+	}
+	l.updateMetrics()
+	return wait, nil
+}
+
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.used > 0 {
+		l.used--
+		l.unsavedChange = true
+	}
+	l.updateMetrics()
+}
+
+// Observe records the upstream answer to a request. A 429 blocks the next
+// requests for its Retry-After, or for a second without one, and is returned
+// as an ExhaustedError.
+func (l *Limiter) Observe(resp *http.Response) error {
+	if l == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	upstreamThrottledCounter.WithLabelValues(l.cfg.Name).Inc()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	until := now.Add(retryAfter(resp.Header.Get("Retry-After"), now))
+	if until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+	return &ExhaustedError{Name: l.cfg.Name, Reason: ReasonUpstream, RetryAfter: l.blockedUntil.Sub(now)}
+}
+
+// Exhaust marks the monthly budget as used, e.g. when the upstream reports
+// the quota of the account is over, and returns the resulting ExhaustedError
+func (l *Limiter) Exhaust() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.exhaustedUntil = nextMonth(now)
+	if l.cfg.MonthlyBudget > 0 {
+		l.used = max(l.used, l.cfg.MonthlyBudget)
+		l.unsavedChange = true
+		l.updateMetrics()
+	}
+	return &ExhaustedError{Name: l.cfg.Name, Reason: ReasonBudget, RetryAfter: nextMonth(now).Sub(now)}
+}
+
+// retryAfter parses a Retry-After value in seconds or as an HTTP date,
+// defaulting to one second
+func retryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return time.Second
+}
+
+// Usage returns the requests counted this month and the budget, zero when
+// unlimited
+func (l *Limiter) Usage() (used, budget int64) {
+	if l == nil {
+		return 0, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.used, l.cfg.MonthlyBudget
+}
+
+// updateMetrics publishes the usage; the caller holds mu
+func (l *Limiter) updateMetrics() {
+	usedGauge.WithLabelValues(l.cfg.Name).Set(float64(l.used))
+	if l.cfg.MonthlyBudget > 0 {
+		budgetGauge.WithLabelValues(l.cfg.Name).Set(float64(l.cfg.MonthlyBudget))
+		remainingGauge.WithLabelValues(l.cfg.Name).Set(float64(max(l.cfg.MonthlyBudget-l.used, 0)))
+	}
+}
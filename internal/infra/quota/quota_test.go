@@ -0,0 +1,173 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(t *testing.T, cfg Config) (*Limiter, *time.Time) {
+	t.Helper()
+	cfg.Name = "test"
+	l, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	now := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	l.last = now
+	l.month = monthOf(now)
+	return l, &now
+}
+
+func reason(err error) string {
+	var exhausted *ExhaustedError
+	if errors.As(err, &exhausted) {
+		return exhausted.Reason
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func TestLimiter_MonthlyBudget(t *testing.T) {
+	l, now := newTestLimiter(t, Config{MonthlyBudget: 2})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := l.Acquire(ctx); err != nil {
+			t.Fatalf("Acquire() #%d error = %v", i, err)
+		}
+	}
+	err := l.Acquire(ctx)
+	if reason(err) != ReasonBudget {
+		t.Fatalf("Acquire() over budget error = %v, want %s", err, ReasonBudget)
+	}
+	var exhausted *ExhaustedError
+	errors.As(err, &exhausted)
+	if exhausted.RetryAfter != time.Hour {
+		t.Errorf("RetryAfter = %s, want the hour left until the next month", exhausted.RetryAfter)
+	}
+	if used, budget := l.Usage(); used != 2 || budget != 2 {
+		t.Errorf("Usage() = %d/%d, want 2/2", used, budget)
+	}
+
+	*now = now.Add(time.Hour)
+	if err := l.Acquire(ctx); err != nil {
+		t.Errorf("Acquire() in the next month error = %v", err)
+	}
+}
+
+func TestLimiter_Rate(t *testing.T) {
+	// deadlines are on the real clock
+	l, err := New(Config{Name: "test", RPS: 10, Burst: 1})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	// the next token is 100ms away: too late for a 10ms deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Acquire(ctx); reason(err) != ReasonRate {
+		t.Errorf("Acquire() with a short deadline error = %v, want %s", err, ReasonRate)
+	}
+
+	start := time.Now()
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire() without deadline error = %v", err)
+	}
+	if waited := time.Since(start); waited < 90*time.Millisecond {
+		t.Errorf("Acquire() waited %s, want about 100ms", waited)
+	}
+}
+
+func TestLimiter_Observe(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		wantErr    bool
+		wantBlock  time.Duration
+	}{
+		{name: "should ignore a success", status: http.StatusOK},
+		{name: "should block for Retry-After seconds", status: http.StatusTooManyRequests, retryAfter: "30", wantErr: true, wantBlock: 30 * time.Second},
+		{name: "should block for a Retry-After date", status: http.StatusTooManyRequests, retryAfter: "Tue, 31 Mar 2026 23:02:00 GMT", wantErr: true, wantBlock: 2 * time.Minute},
+		{name: "should block for a second without Retry-After", status: http.StatusTooManyRequests, wantErr: true, wantBlock: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, now := newTestLimiter(t, Config{})
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+
+			if err := l.Observe(resp); (err != nil) != tt.wantErr {
+				t.Fatalf("Observe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantBlock == 0 {
+				return
+			}
+			*now = now.Add(tt.wantBlock - time.Millisecond)
+			if err := l.Acquire(context.Background()); reason(err) != ReasonUpstream {
+				t.Errorf("Acquire() while blocked error = %v, want %s", err, ReasonUpstream)
+			}
+			*now = now.Add(time.Millisecond)
+			if err := l.Acquire(context.Background()); err != nil {
+				t.Errorf("Acquire() after the block error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLimiter_Exhaust(t *testing.T) {
+	l, _ := newTestLimiter(t, Config{MonthlyBudget: 100})
+	if err := l.Exhaust(); reason(err) != ReasonBudget {
+		t.Fatalf("Exhaust() error = %v, want %s", err, ReasonBudget)
+	}
+	if err := l.Acquire(context.Background()); reason(err) != ReasonBudget {
+		t.Errorf("Acquire() after Exhaust() error = %v, want %s", err, ReasonBudget)
+	}
+}
+
+func TestLimiter_StateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+	l, _ := newTestLimiter(t, Config{MonthlyBudget: 10, StateFile: path})
+	for i := 0; i < 3; i++ {
+		l.Acquire(context.Background())
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reloaded, err := New(Config{MonthlyBudget: 10, StateFile: path})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	// the saved usage belongs to March 2026, so it only carries over when
+	// the clock is still in that month
+	reloaded.month = "2026-03"
+	reloaded.load()
+	if used, _ := reloaded.Usage(); used != 3 {
+		t.Errorf("Usage() after reload = %d, want 3", used)
+	}
+}
+
+func TestLimiter_Nil(t *testing.T) {
+	var l *Limiter
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Errorf("Acquire() on nil error = %v", err)
+	}
+	if err := l.Observe(&http.Response{StatusCode: http.StatusTooManyRequests}); err != nil {
+		t.Errorf("Observe() on nil error = %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+package ratelimit
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var throttledCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_server_rate_limited_total",
+	Help: "Requests answered 429 by the rate limiter per route and client key type",
+}, []string{"route", "key"})
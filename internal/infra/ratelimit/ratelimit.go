@@ -0,0 +1,247 @@
+// Package ratelimit throttles inbound requests with per-client token buckets
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/auth"
+	"gopkg.in/yaml.v3"
+)
+
+// Client keys a bucket can be tracked by
+const (
+	KeyIP     = "ip"
+	KeyAPIKey = "api_key"
+)
+
+// sweepInterval is how often idle buckets are dropped
+const sweepInterval = time.Minute
+
+// Rule is the token bucket applied to every client of a route
+type Rule struct {
+	// Rate is the number of tokens added per second
+	Rate float64 `yaml:"rate"`
+	// Burst is the bucket size; it defaults to the rate rounded up
+	Burst int `yaml:"burst"`
+	// Key is ip (default) or api_key, which keys on the principal verified
+	// by the authentication middleware (the API key name or the JWT subject).
+	// Unauthenticated requests fall back to their client IP, so made-up keys
+	// do not get fresh buckets.
+	Key string `yaml:"key"`
+}
+
+// Config maps route names to their rules; routes not listed are unlimited
+type Config struct {
+	Routes map[string]Rule `yaml:"routes"`
+}
+
+// LoadConfig reads a YAML rate limit configuration. An empty path yields an
+// empty configuration, which limits nothing.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read rate limit config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse rate limit config: %w", err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks every rule of the configuration
+func (c Config) Validate() error {
+	for route, rule := range c.Routes {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("rate limit route %q: %w", route, err)
+		}
+	}
+	return nil
+}
+
+func (r Rule) validate() error {
+	if r.Rate <= 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+	if r.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	switch r.Key {
+	case "", KeyIP, KeyAPIKey:
+	default:
+		return fmt.Errorf("unknown key %q", r.Key)
+	}
+	return nil
+}
+
+// withDefaults fills in the burst and key
+func (r Rule) withDefaults() Rule {
+	if r.Burst == 0 {
+		r.Burst = max(int(math.Ceil(r.Rate)), 1)
+	}
+	if r.Key == "" {
+		r.Key = KeyIP
+	}
+	return r
+}
+
+type bucketKey struct {
+	route  string
+	client string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket up to now and takes a token when there is one.
+// It returns the tokens left and, when throttled, the wait for the next one.
+func (b *bucket) take(rule Rule, now time.Time) (bool, float64, time.Duration) {
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*rule.Rate, float64(rule.Burst))
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, b.tokens, 0
+	}
+	return false, b.tokens, seconds((1 - b.tokens) / rule.Rate)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Limiter applies the rules of its configuration. The configuration can be
+// swapped at runtime with Update, which resets every bucket.
+type Limiter struct {
+	cfg       atomic.Pointer[Config]
+	mu        sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewLimiter creates a Limiter for cfg
+func NewLimiter(cfg Config) *Limiter {
+	l := &Limiter{now: time.Now}
+	l.Update(cfg)
+	return l
+}
+
+// Update replaces the configuration used by the next requests and resets
+// the buckets. The buckets are kept when cfg is the configuration in use, so
+// reloading an unrelated setting does not hand every client a full bucket.
+func (l *Limiter) Update(cfg Config) {
+	if current := l.cfg.Load(); current != nil && reflect.DeepEqual(*current, cfg) {
+		return
+	}
+	l.cfg.Store(&cfg)
+	l.mu.Lock()
+	l.buckets = make(map[bucketKey]*bucket)
+	l.mu.Unlock()
+}
+
+// Config returns the configuration in use
+func (l *Limiter) Config() Config {
+	return *l.cfg.Load()
+}
+
+// allow takes a token from the bucket of client on route
+func (l *Limiter) allow(route, client string, rule Rule) (bool, float64, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+	key := bucketKey{route: route, client: client}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+	return b.take(rule, now)
+}
+
+// sweep drops the buckets idle long enough to be full again, which behave
+// exactly like new ones
+func (l *Limiter) sweep(now time.Time) {
+	routes := l.Config().Routes
+	for key, b := range l.buckets {
+		rule := routes[key.route].withDefaults()
+		if b.tokens+now.Sub(b.last).Seconds()*rule.Rate >= float64(rule.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Route returns the middleware limiting the requests to route. The rule is
+// looked up on every request, so updates apply immediately. A nil Limiter
+// limits nothing.
+func (l *Limiter) Route(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule, ok := l.Config().Routes[route]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rule = rule.withDefaults()
+
+			keyType, client := clientKey(r, rule)
+			allowed, remaining, wait := l.allow(route, client, rule)
+			setHeaders(w.Header(), rule, remaining)
+			if !allowed {
+				throttledCounter.WithLabelValues(route, keyType).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientKey identifies the client of r, returning the kind of key used.
+// RemoteAddr holds the real client IP once middleware.RealIP has run.
+func clientKey(r *http.Request, rule Rule) (string, string) {
+	if rule.Key == KeyAPIKey {
+		if p, ok := auth.FromContext(r.Context()); ok {
+			return KeyAPIKey, "principal:" + p.Method + ":" + p.Subject
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return KeyIP, "ip:" + host
+}
+
+// setHeaders describes the bucket with the RateLimit-* headers: the limit,
+// the whole tokens left and the seconds until the bucket is full again
+func setHeaders(h http.Header, rule Rule, remaining float64) {
+	window := int(math.Ceil(float64(rule.Burst) / rule.Rate))
+	reset := int(math.Ceil((float64(rule.Burst) - remaining) / rule.Rate))
+	h.Set("RateLimit-Limit", strconv.Itoa(rule.Burst))
+	h.Set("RateLimit-Remaining", strconv.Itoa(int(remaining)))
+	h.Set("RateLimit-Reset", strconv.Itoa(reset))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rule.Burst, window))
+}
@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/auth"
+)
+
+func newTestLimiter(cfg Config) (*Limiter, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(cfg)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+// request sends a request from remoteAddr, authenticated as the API key
+// named apiKey unless empty
+func request(handler http.Handler, remoteAddr, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	if apiKey != "" {
+		req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Subject: apiKey, Method: "api_key"}))
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLimiter_Route(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	l, now := newTestLimiter(Config{Routes: map[string]Rule{
+		"ip":  {Rate: 1, Burst: 2},
+		"key": {Rate: 0.5, Burst: 1, Key: KeyAPIKey},
+	}})
+	byIP := l.Route("ip")(ok)
+	byKey := l.Route("key")(ok)
+	unlimited := l.Route("other")(ok)
+
+	throttledBefore := testutil.ToFloat64(throttledCounter.WithLabelValues("ip", KeyIP))
+
+	tests := []struct {
+		name          string
+		handler       http.Handler
+		remoteAddr    string
+		apiKey        string
+		header        string
+		advance       time.Duration
+		wantStatus    int
+		wantRemaining string
+		wantRetry     string
+	}{
+		{name: "should allow the first request", handler: byIP, remoteAddr: "10.0.0.1:1000", wantStatus: http.StatusOK, wantRemaining: "1"},
+		{name: "should allow the burst", handler: byIP, remoteAddr: "10.0.0.1:1001", wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "should throttle past the burst", handler: byIP, remoteAddr: "10.0.0.1:1002", wantStatus: http.StatusTooManyRequests, wantRemaining: "0", wantRetry: "1"},
+		{name: "should keep another client apart", handler: byIP, remoteAddr: "10.0.0.2:1000", wantStatus: http.StatusOK, wantRemaining: "1"},
+		{name: "should refill over time", handler: byIP, remoteAddr: "10.0.0.1:1003", advance: time.Second, wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "should key by API key", handler: byKey, remoteAddr: "10.0.0.1:1000", apiKey: "alpha", wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "should throttle the same API key from another IP", handler: byKey, remoteAddr: "10.0.0.9:1000", apiKey: "alpha", wantStatus: http.StatusTooManyRequests, wantRemaining: "0", wantRetry: "2"},
+		{name: "should keep another API key apart", handler: byKey, remoteAddr: "10.0.0.1:1000", apiKey: "beta", wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "should fall back to the IP without an API key", handler: byKey, remoteAddr: "10.0.0.1:1000", wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "should ignore an unverified API key header", handler: byKey, remoteAddr: "10.0.0.1:1000", header: "made-up", wantStatus: http.StatusTooManyRequests, wantRemaining: "0", wantRetry: "2"},
+		{name: "should not limit routes without a rule", handler: unlimited, remoteAddr: "10.0.0.1:1000", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*now = now.Add(tt.advance)
+			handler := tt.handler
+			if tt.header != "" {
+				// the header alone, as sent before authentication
+				handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					r.Header.Set("X-API-Key", tt.header)
+					tt.handler.ServeHTTP(w, r)
+				})
+			}
+			rec := request(handler, tt.remoteAddr, tt.apiKey)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("RateLimit-Remaining"); got != tt.wantRemaining {
+				t.Errorf("RateLimit-Remaining = %q, want %q", got, tt.wantRemaining)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetry {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetry)
+			}
+		})
+	}
+
+	if got := testutil.ToFloat64(throttledCounter.WithLabelValues("ip", KeyIP)) - throttledBefore; got != 1 {
+		t.Errorf("throttled requests = %v, want 1", got)
+	}
+}
+
+func TestLimiter_Headers(t *testing.T) {
+	l, _ := newTestLimiter(Config{Routes: map[string]Rule{"route": {Rate: 2, Burst: 10}}})
+	rec := request(l.Route("route")(http.NotFoundHandler()), "10.0.0.1:1000", "")
+
+	want := map[string]string{
+		"RateLimit-Limit":     "10",
+		"RateLimit-Remaining": "9",
+		"RateLimit-Reset":     "1",
+		"RateLimit-Policy":    "10;w=5",
+	}
+	for header, value := range want {
+		if got := rec.Header().Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	l, now := newTestLimiter(Config{Routes: map[string]Rule{"route": {Rate: 1, Burst: 1}}})
+	handler := l.Route("route")(http.NotFoundHandler())
+	request(handler, "10.0.0.1:1000", "")
+	request(handler, "10.0.0.2:1000", "")
+
+	*now = now.Add(sweepInterval)
+	request(handler, "10.0.0.3:1000", "")
+	if len(l.buckets) != 1 {
+		t.Errorf("buckets = %d after the sweep, want only the new client", len(l.buckets))
+	}
+}
+
+func TestLimiter_Update(t *testing.T) {
+	l, _ := newTestLimiter(Config{Routes: map[string]Rule{"route": {Rate: 1, Burst: 1}}})
+	handler := l.Route("route")(http.NotFoundHandler())
+	request(handler, "10.0.0.1:1000", "")
+
+	l.Update(Config{Routes: map[string]Rule{"route": {Rate: 1, Burst: 1}}})
+	if rec := request(handler, "10.0.0.1:1000", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d after updating to the same config, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	l.Update(Config{Routes: map[string]Rule{"route": {Rate: 1, Burst: 2}}})
+	if rec := request(handler, "10.0.0.1:1000", ""); rec.Code == http.StatusTooManyRequests {
+		t.Error("status = 429 after changing the config, want the buckets reset")
+	}
+}
+
+func TestLimiter_Nil(t *testing.T) {
+	var l *Limiter
+	if rec := request(l.Route("route")(http.NotFoundHandler()), "10.0.0.1:1000", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want the handler to run", rec.Code)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "should load a valid config", content: "routes:\n  servico-a:\n    rate: 5\n    burst: 10\n    key: api_key\n"},
+		{name: "should reject a missing rate", content: "routes:\n  servico-a:\n    burst: 10\n", wantErr: true},
+		{name: "should reject an unknown key", content: "routes:\n  servico-a:\n    rate: 5\n    key: cookie\n", wantErr: true},
+		{name: "should reject invalid YAML", content: "routes: [", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ratelimit.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadConfig(path); (err != nil) != tt.wantErr {
+				t.Errorf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Package recording records incoming requests to a JSONL file and replays
+// them against another server, reporting the responses that changed.
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/redact"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// maxBodySize caps the request and response bodies kept in a recording
+const maxBodySize = 64 << 10
+
+const tracerName = "github.com/samucadutra/lab-otel-goexpert/internal/infra/recording"
+
+// Entry is a single recorded request, one JSON object per line
+type Entry struct {
+	Time       time.Time   `json:"time"`
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	Status     int         `json:"status"`
+	Response   string      `json:"response,omitempty"`
+	DurationMs float64     `json:"duration_ms"`
+	TraceID    string      `json:"trace_id,omitempty"`
+}
+
+// Recorder appends the requests passing through its middleware to a file
+type Recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	headers []string
+}
+
+// NewRecorder opens path for appending. Only the headers in the allow-list,
+// RECORD_HEADERS, are recorded.
+func NewRecorder(path string, headers []string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording file: %w", err)
+	}
+	return &Recorder{file: file, encoder: json.NewEncoder(file), headers: headers}, nil
+}
+
+// Close closes the recording file
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.file.Close()
+}
+
+// Middleware records every request with its response. It starts a span
+// before the handler, continuing the propagated trace if any, so requests
+// sent without a traceparent are recorded with the trace the handler joins.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, "record "+r.Method)
+		defer span.End()
+		r = r.WithContext(ctx)
+
+		entry := Entry{
+			Time:    time.Now(),
+			Method:  r.Method,
+			Path:    redact.String(r.URL.RequestURI()),
+			Headers: rec.allowed(r.Header),
+		}
+		if sc := span.SpanContext(); sc.IsValid() {
+			entry.TraceID = sc.TraceID().String()
+		}
+
+		if r.Body != nil {
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+			if err != nil {
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			// the handler reads what was consumed followed by the rest
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			entry.Body = string(body)
+		}
+
+		var response limitedBuffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&response)
+		defer func() {
+			entry.Status = ww.Status()
+			if entry.Status == 0 {
+				entry.Status = http.StatusOK
+			}
+			entry.Response = response.String()
+			entry.DurationMs = float64(time.Since(entry.Time).Microseconds()) / 1000
+			rec.write(entry)
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+func (rec *Recorder) write(entry Entry) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	// a failed write must not fail the request being recorded
+	_ = rec.encoder.Encode(entry)
+}
+
+func (rec *Recorder) allowed(header http.Header) http.Header {
+	out := http.Header{}
+	for _, name := range rec.headers {
+		if values := header.Values(name); len(values) > 0 {
+			out[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	// an allow-listed credential is kept masked
+	return redact.Header(out)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limitedBuffer keeps the first maxBodySize bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxBodySize - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
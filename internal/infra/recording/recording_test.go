@@ -0,0 +1,167 @@
+package recording
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestRecorder_Middleware(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+
+	rec, err := NewRecorder(path, []string{"content-type", "X-Tenant"})
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	handler := rec.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"cep":"01001000"}` {
+			t.Errorf("handler read body %q", body)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"city":"São Paulo"}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/weather/servico-a?debug=1", strings.NewReader(`{"cep":"01001000"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	entries, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	got := entries[0]
+	if got.Method != http.MethodPost || got.Path != "/weather/servico-a?debug=1" {
+		t.Errorf("recorded %s %s", got.Method, got.Path)
+	}
+	if got.Body != `{"cep":"01001000"}` || got.Response != `{"city":"São Paulo"}` || got.Status != http.StatusCreated {
+		t.Errorf("recorded body %q, response %q, status %d", got.Body, got.Response, got.Status)
+	}
+	if got.Headers.Get("Content-Type") != "application/json" || got.Headers.Get("Authorization") != "" {
+		t.Errorf("recorded headers %v, want only the allow-list", got.Headers)
+	}
+	if got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("recorded trace ID %q", got.TraceID)
+	}
+}
+
+func TestRecorder_Middleware_TraceID(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	defer otel.SetTracerProvider(previous)
+
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	rec, err := NewRecorder(path, nil)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	// the handler starts its server span like the weather handlers do
+	var handlerTraceID string
+	handler := rec.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		_, span := otel.Tracer("test").Start(ctx, "handler")
+		defer span.End()
+		handlerTraceID = span.SpanContext().TraceID().String()
+	}))
+
+	// no traceparent: the trace starts in the server
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	entries, err := ReadFile(path)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadFile() = %d entries, error %v", len(entries), err)
+	}
+	if entries[0].TraceID == "" || entries[0].TraceID != handlerTraceID {
+		t.Errorf("recorded trace ID %q, want the handler trace %q", entries[0].TraceID, handlerTraceID)
+	}
+	if entries[0].Headers != nil {
+		t.Errorf("recorded headers %v without an allow-list", entries[0].Headers)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch string(body) {
+		case "same":
+			w.Write([]byte(`{"uf":"SP","temp_C":20}`))
+		case "changed":
+			w.Write([]byte(`{"uf":"RJ","temp_C":30}`))
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	entries := []Entry{
+		{Time: start, Method: http.MethodPost, Path: "/", Body: "same", Status: 200, Response: `{"uf":"SP","temp_C":25}`},
+		{Time: start.Add(100 * time.Millisecond), Method: http.MethodPost, Path: "/", Body: "changed", Status: 200, Response: `{"uf":"SP","temp_C":25}`},
+		{Time: start.Add(200 * time.Millisecond), Method: http.MethodPost, Path: "/", Body: "error", Status: 200, Response: `{"uf":"SP"}`},
+	}
+
+	began := time.Now()
+	outcomes := Replay(context.Background(), entries, ReplayConfig{Target: server.URL, Speed: 2, IgnoreFields: []string{"temp_C"}})
+	if elapsed := time.Since(began); elapsed < 100*time.Millisecond {
+		t.Errorf("replay took %s, want the recorded timing halved", elapsed)
+	}
+
+	want := [][]string{
+		nil,
+		{`uf: "SP" -> "RJ"`},
+		{"status: 200 -> 500", `body: "{\"uf\":\"SP\"}" -> "boom"`},
+	}
+	for i, outcome := range outcomes {
+		if outcome.Err != nil {
+			t.Fatalf("entry %d: unexpected error %v", i, outcome.Err)
+		}
+		if strings.Join(outcome.Diffs, "\n") != strings.Join(want[i], "\n") {
+			t.Errorf("entry %d: diffs = %q, want %q", i, outcome.Diffs, want[i])
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		recorded string
+		replayed string
+		want     []string
+	}{
+		{name: "should match equal JSON with different formatting", recorded: `{"a":1, "b":"x"}`, replayed: `{"b":"x","a":1}`},
+		{name: "should report changed, added and removed fields", recorded: `{"a":1,"b":2}`, replayed: `{"a":2,"c":3}`,
+			want: []string{"a: 1 -> 2", "b: removed (was 2)", "c: added 3"}},
+		{name: "should compare plain text ignoring surrounding spaces", recorded: "not found\n", replayed: "not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Diff(tt.recorded, tt.replayed, nil)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReadFile parses a JSONL recording, ordered by request time
+func ReadFile(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64<<10), 4*maxBodySize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid recording entry on line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// ReplayConfig describes how a recording is replayed
+type ReplayConfig struct {
+	// Target is the base URL the recorded paths are sent to
+	Target string
+	// Speed multiplies the recorded pace: 1 keeps the relative timing, 2
+	// replays twice as fast and 0 sends every request back to back
+	Speed float64
+	// IgnoreFields lists JSON response fields left out of the comparison,
+	// such as temperatures that change between runs
+	IgnoreFields []string
+	Client       *http.Client
+}
+
+// Outcome is the replayed response of an entry and how it differs from the
+// recorded one
+type Outcome struct {
+	Entry    Entry
+	Status   int
+	Response string
+	Err      error
+	// Diffs is empty when the response matches the recording
+	Diffs []string
+}
+
+// Replay re-sends the entries to cfg.Target and returns one outcome per
+// entry, in the recording order
+func Replay(ctx context.Context, entries []Entry, cfg ReplayConfig) []Outcome {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	target := strings.TrimRight(cfg.Target, "/")
+
+	outcomes := make([]Outcome, len(entries))
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, entry := range entries {
+		if cfg.Speed > 0 {
+			offset := entry.Time.Sub(entries[0].Time)
+			if !sleepUntil(ctx, start.Add(time.Duration(float64(offset)/cfg.Speed))) {
+				for j := i; j < len(entries); j++ {
+					outcomes[j] = Outcome{Entry: entries[j], Err: ctx.Err()}
+				}
+				break
+			}
+		}
+
+		send := func() {
+			outcomes[i] = replay(ctx, cfg.Client, target, entry, cfg.IgnoreFields)
+		}
+		if cfg.Speed <= 0 {
+			send()
+			continue
+		}
+		// requests overlap as they did when recorded
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			send()
+		}()
+	}
+	wg.Wait()
+	return outcomes
+}
+
+func replay(ctx context.Context, client *http.Client, target string, entry Entry, ignore []string) Outcome {
+	out := Outcome{Entry: entry}
+
+	req, err := http.NewRequestWithContext(ctx, entry.Method, target+entry.Path, strings.NewReader(entry.Body))
+	if err != nil {
+		out.Err = err
+		return out
+	}
+	for name, values := range entry.Headers {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		out.Err = err
+		return out
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		out.Err = err
+		return out
+	}
+
+	out.Status = resp.StatusCode
+	out.Response = string(body)
+	if out.Status != entry.Status {
+		out.Diffs = append(out.Diffs, fmt.Sprintf("status: %d -> %d", entry.Status, out.Status))
+	}
+	out.Diffs = append(out.Diffs, Diff(entry.Response, out.Response, ignore)...)
+	return out
+}
+
+// Diff compares two response bodies. JSON objects are compared field by
+// field, skipping the ignored fields; anything else is compared as text.
+func Diff(recorded, replayed string, ignore []string) []string {
+	var before, after map[string]any
+	if json.Unmarshal([]byte(recorded), &before) != nil || json.Unmarshal([]byte(replayed), &after) != nil {
+		if strings.TrimSpace(recorded) == strings.TrimSpace(replayed) {
+			return nil
+		}
+		return []string{fmt.Sprintf("body: %q -> %q", strings.TrimSpace(recorded), strings.TrimSpace(replayed))}
+	}
+
+	skip := make(map[string]bool, len(ignore))
+	for _, field := range ignore {
+		skip[field] = true
+	}
+	fields := make(map[string]bool, len(before)+len(after))
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		if !skip[field] {
+			names = append(names, field)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []string
+	for _, field := range names {
+		b, inBefore := before[field]
+		a, inAfter := after[field]
+		switch {
+		case !inBefore:
+			diffs = append(diffs, fmt.Sprintf("%s: added %s", field, encode(a)))
+		case !inAfter:
+			diffs = append(diffs, fmt.Sprintf("%s: removed (was %s)", field, encode(b)))
+		case !reflect.DeepEqual(a, b):
+			diffs = append(diffs, fmt.Sprintf("%s: %s -> %s", field, encode(b), encode(a)))
+		}
+	}
+	return diffs
+}
+
+func encode(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
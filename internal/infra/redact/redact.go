@@ -0,0 +1,169 @@
+// Package redact masks secrets, such as API keys sent as query parameters or
+// headers, before URLs, headers, errors, logs and spans leave the process
+package redact
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Placeholder replaces a redacted value
+const Placeholder = "REDACTED"
+
+// DefaultQueryParams are the query parameters always redacted
+var DefaultQueryParams = []string{
+	"key", "api_key", "apikey", "access_token", "token", "client_secret", "password", "sig", "signature",
+}
+
+// DefaultHeaders are the headers always redacted
+var DefaultHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-API-Key",
+}
+
+// Config lists the sensitive names, added to the defaults
+type Config struct {
+	QueryParams []string
+	Headers     []string
+}
+
+// Redactor masks the values of the sensitive query parameters and headers
+type Redactor struct {
+	params  []string
+	headers []string
+	// query matches a sensitive parameter with its value in free text
+	query *regexp.Regexp
+}
+
+// New creates a Redactor for the defaults plus the names in cfg. Query
+// parameters and headers are matched case-insensitively.
+func New(cfg Config) *Redactor {
+	r := &Redactor{}
+	for _, name := range append(slices.Clone(DefaultQueryParams), cfg.QueryParams...) {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" && !slices.Contains(r.params, name) {
+			r.params = append(r.params, name)
+		}
+	}
+	for _, name := range append(slices.Clone(DefaultHeaders), cfg.Headers...) {
+		if name = http.CanonicalHeaderKey(strings.TrimSpace(name)); name != "" && !slices.Contains(r.headers, name) {
+			r.headers = append(r.headers, name)
+		}
+	}
+
+	quoted := make([]string, len(r.params))
+	for i, name := range r.params {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	// the value runs until the next parameter, fragment, quote or space
+	r.query = regexp.MustCompile(`(?i)([?&;](?:` + strings.Join(quoted, "|") + `)=)[^&;#\s"'<>]*`)
+	return r
+}
+
+var (
+	defaultMu sync.RWMutex
+	std       = New(Config{})
+)
+
+// Default returns the Redactor used by the package functions
+func Default() *Redactor {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return std
+}
+
+// SetDefault replaces the Redactor used by the package functions
+func SetDefault(r *Redactor) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	std = r
+}
+
+// IsSensitiveHeader reports whether the values of the header are redacted
+func (r *Redactor) IsSensitiveHeader(name string) bool {
+	return slices.Contains(r.headers, http.CanonicalHeaderKey(name))
+}
+
+// URL returns u as a string with the sensitive query parameters and the
+// password masked
+func (r *Redactor) URL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	masked := *u
+	if masked.RawQuery != "" {
+		query := masked.Query()
+		for name := range query {
+			if slices.Contains(r.params, strings.ToLower(name)) {
+				query[name] = []string{Placeholder}
+			}
+		}
+		masked.RawQuery = query.Encode()
+	}
+	return masked.Redacted()
+}
+
+// String masks the sensitive query parameters of the URLs found in s
+func (r *Redactor) String(s string) string {
+	if !strings.Contains(s, "=") {
+		return s
+	}
+	return r.query.ReplaceAllString(s, "${1}"+Placeholder)
+}
+
+// Header returns a copy of h with the values of the sensitive headers masked
+func (r *Redactor) Header(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	masked := h.Clone()
+	for name, values := range masked {
+		if r.IsSensitiveHeader(name) {
+			masked[name] = slices.Repeat([]string{Placeholder}, len(values))
+		}
+	}
+	return masked
+}
+
+// Error returns err with its message redacted. A *url.Error keeps its type,
+// so timeouts and the wrapped cause are still detected; other errors are
+// wrapped.
+func (r *Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && err == error(urlErr) {
+		return &url.Error{Op: urlErr.Op, URL: r.String(urlErr.URL), Err: r.Error(urlErr.Err)}
+	}
+	msg := err.Error()
+	if masked := r.String(msg); masked != msg {
+		return &redactedError{msg: masked, err: err}
+	}
+	return err
+}
+
+// redactedError keeps the original error for errors.Is and errors.As
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// URL masks u with the default Redactor
+func URL(u *url.URL) string { return Default().URL(u) }
+
+// String masks s with the default Redactor
+func String(s string) string { return Default().String(s) }
+
+// Header masks h with the default Redactor
+func Header(h http.Header) http.Header { return Default().Header(h) }
+
+// Error masks err with the default Redactor
+func Error(err error) error { return Default().Error(err) }
@@ -0,0 +1,117 @@
+package redact
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Writer masks what is written to w, e.g. the output of the log package,
+// which writes a whole line at a time
+func Writer(w io.Writer) io.Writer {
+	return writer{w}
+}
+
+type writer struct {
+	w io.Writer
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Exporter masks the names, attributes, events and status of the spans
+// before handing them to next
+func Exporter(next sdktrace.SpanExporter) sdktrace.SpanExporter {
+	return exporter{next}
+}
+
+type exporter struct {
+	next sdktrace.SpanExporter
+}
+
+func (e exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	r := Default()
+	masked := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, s := range spans {
+		masked[i] = maskedSpan{ReadOnlySpan: s, r: r}
+	}
+	return e.next.ExportSpans(ctx, masked)
+}
+
+func (e exporter) Shutdown(ctx context.Context) error {
+	return e.next.Shutdown(ctx)
+}
+
+// maskedSpan passes everything of the span through but its name,
+// attributes, events and status, which it masks
+type maskedSpan struct {
+	sdktrace.ReadOnlySpan
+	r *Redactor
+}
+
+func (s maskedSpan) Name() string {
+	return s.r.String(s.ReadOnlySpan.Name())
+}
+
+func (s maskedSpan) Attributes() []attribute.KeyValue {
+	return s.r.attributes(s.ReadOnlySpan.Attributes())
+}
+
+func (s maskedSpan) Events() []sdktrace.Event {
+	events := s.ReadOnlySpan.Events()
+	masked := make([]sdktrace.Event, len(events))
+	for i, event := range events {
+		event.Name = s.r.String(event.Name)
+		event.Attributes = s.r.attributes(event.Attributes)
+		masked[i] = event
+	}
+	return masked
+}
+
+func (s maskedSpan) Status() sdktrace.Status {
+	status := s.ReadOnlySpan.Status()
+	status.Description = s.r.String(status.Description)
+	return status
+}
+
+// headerAttributePrefixes are the semantic convention keys of captured
+// headers, followed by the lowercase header name
+var headerAttributePrefixes = []string{"http.request.header.", "http.response.header."}
+
+func (r *Redactor) attributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	masked := make([]attribute.KeyValue, len(attrs))
+	for i, kv := range attrs {
+		masked[i] = kv
+		if r.isHeaderAttribute(string(kv.Key)) {
+			masked[i] = kv.Key.String(Placeholder)
+			continue
+		}
+		switch kv.Value.Type() {
+		case attribute.STRING:
+			masked[i] = kv.Key.String(r.String(kv.Value.AsString()))
+		case attribute.STRINGSLICE:
+			values := kv.Value.AsStringSlice()
+			for j := range values {
+				values[j] = r.String(values[j])
+			}
+			masked[i] = kv.Key.StringSlice(values)
+		}
+	}
+	return masked
+}
+
+func (r *Redactor) isHeaderAttribute(key string) bool {
+	for _, prefix := range headerAttributePrefixes {
+		if name, ok := strings.CutPrefix(key, prefix); ok {
+			return r.IsSensitiveHeader(strings.ReplaceAll(name, "_", "-"))
+		}
+	}
+	return false
+}
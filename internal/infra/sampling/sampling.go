@@ -0,0 +1,46 @@
+// Package sampling provides a trace sampler whose ratio can be changed while
+// the process runs
+package sampling
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Sampler records a ratio of the new traces and follows the decision of the
+// parent span for the others, so a trace is kept or dropped as a whole
+type Sampler struct {
+	current atomic.Pointer[state]
+}
+
+type state struct {
+	ratio   float64
+	sampler sdktrace.Sampler
+}
+
+// New creates a Sampler recording ratio of the new traces, from 0 to 1
+func New(ratio float64) *Sampler {
+	s := &Sampler{}
+	s.SetRatio(ratio)
+	return s
+}
+
+// SetRatio changes the ratio for the spans started from now on
+func (s *Sampler) SetRatio(ratio float64) {
+	s.current.Store(&state{ratio: ratio, sampler: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))})
+}
+
+// Ratio returns the ratio in use
+func (s *Sampler) Ratio() float64 {
+	return s.current.Load().ratio
+}
+
+func (s *Sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return s.current.Load().sampler.ShouldSample(p)
+}
+
+func (s *Sampler) Description() string {
+	return fmt.Sprintf("Reloadable{%s}", s.current.Load().sampler.Description())
+}
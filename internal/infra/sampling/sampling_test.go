@@ -0,0 +1,62 @@
+package sampling
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSampler_SetRatio(t *testing.T) {
+	tests := []struct {
+		name  string
+		ratio float64
+		want  int
+	}{
+		{name: "should drop every trace", ratio: 0, want: 0},
+		{name: "should keep every trace", ratio: 1, want: 10},
+	}
+
+	sampler := New(0.5)
+	memory := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler), sdktrace.WithSyncer(memory))
+	defer provider.Shutdown(context.Background())
+	tracer := provider.Tracer("test")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory.Reset()
+			sampler.SetRatio(tt.ratio)
+			if sampler.Ratio() != tt.ratio {
+				t.Errorf("Ratio() = %v, want %v", sampler.Ratio(), tt.ratio)
+			}
+			for i := 0; i < 10; i++ {
+				_, span := tracer.Start(context.Background(), "span")
+				span.End()
+			}
+			if got := len(memory.GetSpans()); got != tt.want {
+				t.Errorf("recorded %d spans, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampler_FollowsParent(t *testing.T) {
+	sampler := New(1)
+	memory := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler), sdktrace.WithSyncer(memory))
+	defer provider.Shutdown(context.Background())
+	tracer := provider.Tracer("test")
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	// a trace already being recorded stays complete after the ratio drops
+	sampler.SetRatio(0)
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	parent.End()
+
+	if got := len(memory.GetSpans()); got != 2 {
+		t.Errorf("recorded %d spans, want the parent and the child", got)
+	}
+}
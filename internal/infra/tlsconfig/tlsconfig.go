@@ -0,0 +1,247 @@
+// Package tlsconfig builds the TLS configurations of the listener and of the
+// servico-a → servico-b client, with certificates reloaded from disk when the
+// files change.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// PeerIdentityKey records the identity of the certificate presented by the
+// other side of a connection
+const PeerIdentityKey = attribute.Key("tls.peer.identity")
+
+// Client authentication modes of the listener
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// CertReloader serves a certificate and key pair from disk, loading them
+// again when either file changes. Files are checked at most once per
+// interval, on the handshake path, so no background worker is needed.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+	now       func() time.Time
+}
+
+// NewCertReloader loads the pair, failing when it is invalid
+func NewCertReloader(certFile, keyFile string, interval time.Duration) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, interval: interval, now: time.Now}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.checkedAt = r.now()
+	return r, nil
+}
+
+// Certificate returns the current pair, reloading it if the files changed.
+// A pair that fails to load keeps the previous one in use.
+func (r *CertReloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.now().Sub(r.checkedAt) >= r.interval {
+		r.checkedAt = r.now()
+		if modTime, err := r.latestModTime(); err == nil && modTime.After(r.modTime) {
+			r.load()
+		}
+	}
+	return r.cert
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// load reads the pair; callers hold mu
+func (r *CertReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, fmt.Errorf("failed to read certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// LoadCAPool reads the PEM bundles in a comma separated list of files
+func LoadCAPool(files string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, file := range strings.Split(files, ",") {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %s", file)
+		}
+	}
+	return pool, nil
+}
+
+// ServerOptions configures the TLS listener
+type ServerOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFiles verifies client certificates; comma separated
+	ClientCAFiles string
+	// ClientAuth is none, optional or require; it defaults to require when
+	// ClientCAFiles is set and to none otherwise
+	ClientAuth     string
+	ReloadInterval time.Duration
+}
+
+// Server returns the listener TLS configuration, or nil when no certificate
+// is configured
+func Server(opts ServerOptions) (*tls.Config, error) {
+	if opts.CertFile == "" && opts.KeyFile == "" {
+		return nil, nil
+	}
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("TLS needs both a certificate and a key file")
+	}
+
+	reloader, err := NewCertReloader(opts.CertFile, opts.KeyFile, opts.ReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: reloader.GetCertificate}
+
+	mode := opts.ClientAuth
+	if mode == "" {
+		mode = ClientAuthNone
+		if opts.ClientCAFiles != "" {
+			mode = ClientAuthRequire
+		}
+	}
+	switch mode {
+	case ClientAuthNone:
+		return cfg, nil
+	case ClientAuthOptional:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("invalid client auth %q: must be none, optional or require", mode)
+	}
+	if opts.ClientCAFiles == "" {
+		return nil, fmt.Errorf("client auth %q needs a client CA bundle", mode)
+	}
+	if cfg.ClientCAs, err = LoadCAPool(opts.ClientCAFiles); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ClientOptions configures TLS on outbound requests
+type ClientOptions struct {
+	// CAFiles verifies the server certificates; comma separated, the system
+	// pool is used when empty
+	CAFiles string
+	// CertFile and KeyFile are presented when the server asks for a client
+	// certificate
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name verified in the server certificate
+	ServerName     string
+	ReloadInterval time.Duration
+}
+
+// Client returns the outbound TLS configuration, or nil when nothing is
+// configured and the defaults apply
+func Client(opts ClientOptions) (*tls.Config, error) {
+	if opts.CAFiles == "" && opts.CertFile == "" && opts.KeyFile == "" && opts.ServerName == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: opts.ServerName}
+	if opts.CAFiles != "" {
+		pool, err := LoadCAPool(opts.CAFiles)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, errors.New("a client certificate needs both a certificate and a key file")
+		}
+		reloader, err := NewCertReloader(opts.CertFile, opts.KeyFile, opts.ReloadInterval)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = reloader.GetClientCertificate
+	}
+	return cfg, nil
+}
+
+// PeerIdentity names the leaf certificate presented by the peer: its first
+// URI SAN (such as a SPIFFE ID), else its first DNS SAN, else its common name
+func PeerIdentity(state *tls.ConnectionState) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	leaf := state.PeerCertificates[0]
+	switch {
+	case len(leaf.URIs) > 0:
+		return leaf.URIs[0].String()
+	case len(leaf.DNSNames) > 0:
+		return leaf.DNSNames[0]
+	}
+	return leaf.Subject.CommonName
+}
+
+// PeerAttributes returns the span attributes describing the peer, if any
+func PeerAttributes(state *tls.ConnectionState) []attribute.KeyValue {
+	if id := PeerIdentity(state); id != "" {
+		return []attribute.KeyValue{PeerIdentityKey.String(id)}
+	}
+	return nil
+}
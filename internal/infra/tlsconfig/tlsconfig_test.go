@@ -0,0 +1,228 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	file := filepath.Join(dir, name+".pem")
+	os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// issue writes a leaf certificate signed by the CA and returns its files
+func (ca *testCA) issue(t *testing.T, dir, name string, tmpl *x509.Certificate) (string, string) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	otherCA := newTestCA(t, dir, "other-ca")
+	serverCert, serverKey := ca.issue(t, dir, "servico-b", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "servico-b"},
+		DNSNames:    []string{"servico-b"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	})
+	spiffe, _ := url.Parse("spiffe://lab/servico-a")
+	clientCert, clientKey := ca.issue(t, dir, "servico-a", &x509.Certificate{
+		Subject: pkix.Name{CommonName: "servico-a"},
+		URIs:    []*url.URL{spiffe},
+	})
+	strangerCert, strangerKey := otherCA.issue(t, dir, "stranger", &x509.Certificate{
+		Subject: pkix.Name{CommonName: "stranger"},
+	})
+
+	serverTLS, err := Server(ServerOptions{CertFile: serverCert, KeyFile: serverKey, ClientCAFiles: ca.file, ReloadInterval: time.Second})
+	if err != nil {
+		t.Fatalf("Server() error = %v", err)
+	}
+	if serverTLS.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("ClientAuth = %v, want client certificates required with a CA bundle", serverTLS.ClientAuth)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(PeerIdentity(r.TLS)))
+	}))
+	// StartTLS would install its own certificate, so the listener is wrapped
+	// by hand to serve the one from the reloader
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.Listener = tls.NewListener(server.Listener, serverTLS)
+	server.Start()
+	defer server.Close()
+	serverURL := "https://" + server.Listener.Addr().String()
+
+	tests := []struct {
+		name         string
+		opts         ClientOptions
+		wantIdentity string
+		wantErr      bool
+	}{
+		{
+			name:         "should identify a client with a trusted certificate",
+			opts:         ClientOptions{CAFiles: ca.file, CertFile: clientCert, KeyFile: clientKey},
+			wantIdentity: "spiffe://lab/servico-a",
+		},
+		{
+			name:    "should reject a client without a certificate",
+			opts:    ClientOptions{CAFiles: ca.file},
+			wantErr: true,
+		},
+		{
+			name:    "should reject a client certificate from another CA",
+			opts:    ClientOptions{CAFiles: ca.file, CertFile: strangerCert, KeyFile: strangerKey},
+			wantErr: true,
+		},
+		{
+			name:    "should reject a server not signed by the configured CA",
+			opts:    ClientOptions{CAFiles: otherCA.file, CertFile: clientCert, KeyFile: clientKey},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientTLS, err := Client(tt.opts)
+			if err != nil {
+				t.Fatalf("Client() error = %v", err)
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			resp, err := client.Get(serverURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+
+			body := make([]byte, 64)
+			n, _ := resp.Body.Read(body)
+			if got := string(body[:n]); got != tt.wantIdentity {
+				t.Errorf("server saw identity %q, want %q", got, tt.wantIdentity)
+			}
+			if got := PeerIdentity(resp.TLS); got != "servico-b" {
+				t.Errorf("client saw identity %q, want servico-b", got)
+			}
+		})
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	certFile, keyFile := ca.issue(t, dir, "server", &x509.Certificate{Subject: pkix.Name{CommonName: "first"}})
+
+	r, err := NewCertReloader(certFile, keyFile, time.Minute)
+	if err != nil {
+		t.Fatalf("NewCertReloader() error = %v", err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	commonName := func() string {
+		leaf, _ := x509.ParseCertificate(r.Certificate().Certificate[0])
+		return leaf.Subject.CommonName
+	}
+
+	newCert, newKey := ca.issue(t, dir, "rotated", &x509.Certificate{Subject: pkix.Name{CommonName: "second"}})
+	os.Rename(newCert, certFile)
+	os.Rename(newKey, keyFile)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+
+	if got := commonName(); got != "first" {
+		t.Errorf("certificate = %q before the reload interval, want first", got)
+	}
+	now = now.Add(2 * time.Minute)
+	if got := commonName(); got != "second" {
+		t.Errorf("certificate = %q after the files changed, want second", got)
+	}
+
+	os.WriteFile(certFile, []byte("broken"), 0o600)
+	muchLater := time.Now().Add(time.Hour)
+	os.Chtimes(certFile, muchLater, muchLater)
+	now = now.Add(2 * time.Minute)
+	if got := commonName(); got != "second" {
+		t.Errorf("certificate = %q after a broken update, want the previous one kept", got)
+	}
+}
+
+func TestServer_Options(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ServerOptions
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "should stay on plain HTTP without a certificate", opts: ServerOptions{}, wantNil: true},
+		{name: "should need both files", opts: ServerOptions{CertFile: "cert.pem"}, wantErr: true},
+		{name: "should reject an unknown client auth", opts: ServerOptions{CertFile: "x", KeyFile: "y", ClientAuth: "maybe"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Server(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Server() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (cfg == nil) != tt.wantNil && !tt.wantErr {
+				t.Errorf("Server() = %v, want nil %v", cfg, tt.wantNil)
+			}
+		})
+	}
+}
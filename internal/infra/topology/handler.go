@@ -0,0 +1,171 @@
+package topology
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/chaos"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/deadline"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/samucadutra/lab-otel-goexpert/internal/infra/topology"
+
+// CallResult is the outcome of a downstream call, as reported in the response
+type CallResult struct {
+	Name       string  `json:"name"`
+	URL        string  `json:"url"`
+	Status     int     `json:"status,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Response is the body returned by the topology handler
+type Response struct {
+	Service string       `json:"service"`
+	Calls   []CallResult `json:"calls"`
+}
+
+// Handler makes the calls of a single service of the topology
+type Handler struct {
+	name    string
+	service Service
+	client  *http.Client
+	tracer  trace.Tracer
+	random  func() float64
+	normal  func() float64
+}
+
+// NewHandler creates the handler of the service name
+func NewHandler(name string, service Service) *Handler {
+	return &Handler{
+		name:    name,
+		service: service,
+		client:  http.DefaultClient,
+		tracer:  otel.Tracer(tracerName),
+		random:  rand.Float64,
+		normal:  rand.NormFloat64,
+	}
+}
+
+// ServeHTTP runs the calls of the service and answers with their outcome,
+// failing with 502 when any of them failed so errors cascade up the graph
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := h.tracer.Start(ctx, "topology "+h.name, trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("topology.service", h.name),
+			attribute.String("topology.mode", h.service.Mode),
+		))
+	defer span.End()
+
+	response := Response{Service: h.name, Calls: h.run(ctx)}
+
+	status := http.StatusOK
+	for _, call := range response.Calls {
+		if call.Error != "" {
+			status = http.StatusBadGateway
+			span.SetStatus(codes.Error, "downstream call failed")
+			break
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) run(ctx context.Context) []CallResult {
+	results := make([]CallResult, len(h.service.Calls))
+	if h.service.Mode != Parallel {
+		for i, call := range h.service.Calls {
+			results[i] = h.call(ctx, call)
+		}
+		return results
+	}
+
+	var wg sync.WaitGroup
+	for i, call := range h.service.Calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = h.call(ctx, call)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (h *Handler) call(ctx context.Context, call Call) (result CallResult) {
+	result = CallResult{Name: call.Name, URL: call.URL}
+	start := time.Now()
+	defer func() {
+		result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	}()
+
+	ctx, span := h.tracer.Start(ctx, "call "+call.Name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("topology.call", call.Name),
+			attribute.String("http.method", call.Method),
+			attribute.String("http.url", call.URL),
+		))
+	defer span.End()
+
+	fail := func(err string) CallResult {
+		result.Error = err
+		span.SetStatus(codes.Error, err)
+		return result
+	}
+
+	if latency := call.Latency.Sample(h.random, h.normal); latency > 0 {
+		span.SetAttributes(attribute.Int64("topology.latency_ms", latency.Milliseconds()))
+		if err := chaos.Wait(ctx, latency); err != nil {
+			return fail(err.Error())
+		}
+	}
+	if call.ErrorRate > 0 && h.random() < call.ErrorRate {
+		span.SetAttributes(attribute.Bool("topology.injected_error", true))
+		return fail("error injected by topology")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, call.Timeout)
+	defer cancel()
+
+	var body io.Reader
+	if call.Body != "" {
+		body = strings.NewReader(call.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, call.Method, call.URL, body)
+	if err != nil {
+		return fail(err.Error())
+	}
+	for name, value := range call.Headers {
+		req.Header.Set(name, value)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	deadline.Inject(ctx, req.Header)
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fail(err.Error())
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	result.Status = resp.StatusCode
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fail(fmt.Sprintf("downstream answered %s", resp.Status))
+	}
+	return result
+}
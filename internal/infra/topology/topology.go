@@ -0,0 +1,113 @@
+// Package topology simulates a microservice graph: each instance of the
+// binary looks up its own service in a shared YAML file and, on every
+// request, calls the downstream services listed for it.
+package topology
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/chaos"
+	"gopkg.in/yaml.v3"
+)
+
+// Execution modes of the calls of a service
+const (
+	Sequential = "sequential"
+	Parallel   = "parallel"
+)
+
+// defaultCallTimeout bounds a call without an explicit timeout
+const defaultCallTimeout = 10 * time.Second
+
+// Call is a downstream request made by a service
+type Call struct {
+	Name    string            `yaml:"name"`
+	Method  string            `yaml:"method"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	Timeout time.Duration     `yaml:"timeout"`
+	// Latency is waited before the request is sent, simulating local work
+	Latency *chaos.Latency `yaml:"latency"`
+	// ErrorRate is the probability of failing the call without sending it
+	ErrorRate float64 `yaml:"error_rate"`
+}
+
+// Service lists the calls made by a service for each request it receives
+type Service struct {
+	Mode  string `yaml:"mode"`
+	Calls []Call `yaml:"calls"`
+}
+
+// Config maps service names to their calls
+type Config struct {
+	Services map[string]Service `yaml:"services"`
+}
+
+// LoadConfig reads a YAML topology. An empty path yields an empty topology.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read topology: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse topology: %w", err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks every service of the topology and fills in the defaults
+func (c Config) Validate() error {
+	for name, svc := range c.Services {
+		if err := svc.validate(); err != nil {
+			return fmt.Errorf("topology service %q: %w", name, err)
+		}
+		c.Services[name] = svc
+	}
+	return nil
+}
+
+func (s *Service) validate() error {
+	switch s.Mode {
+	case "":
+		s.Mode = Sequential
+	case Sequential, Parallel:
+	default:
+		return fmt.Errorf("unknown mode %q", s.Mode)
+	}
+
+	for i := range s.Calls {
+		call := &s.Calls[i]
+		if call.Method == "" {
+			call.Method = http.MethodGet
+		}
+		if call.Timeout <= 0 {
+			call.Timeout = defaultCallTimeout
+		}
+		u, err := url.Parse(call.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("call %d: invalid url %q", i, call.URL)
+		}
+		if call.Name == "" {
+			call.Name = call.Method + " " + u.Host + u.Path
+		}
+		if call.ErrorRate < 0 || call.ErrorRate > 1 {
+			return fmt.Errorf("call %q: error_rate must be between 0 and 1", call.Name)
+		}
+		if call.Latency != nil {
+			if err := call.Latency.Validate(); err != nil {
+				return fmt.Errorf("call %q: %w", call.Name, err)
+			}
+		}
+	}
+	return nil
+}
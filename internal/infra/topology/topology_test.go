@@ -0,0 +1,195 @@
+package topology
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/chaos"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0o644)
+		return path
+	}
+
+	valid := write("valid.yaml", `
+services:
+  gateway:
+    mode: parallel
+    calls:
+      - name: orders
+        method: POST
+        url: http://orders:8080/topology
+        headers:
+          X-Tenant: demo
+        body: '{"id": 1}'
+        latency:
+          distribution: fixed
+          value: 20ms
+        error_rate: 0.1
+      - url: http://users:8080/topology
+  users: {}
+`)
+	cfg, err := LoadConfig(valid)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	gateway := cfg.Services["gateway"]
+	if gateway.Mode != Parallel || len(gateway.Calls) != 2 {
+		t.Fatalf("gateway = %+v", gateway)
+	}
+	if orders := gateway.Calls[0]; orders.Method != http.MethodPost || orders.Headers["X-Tenant"] != "demo" || orders.Latency.Value != 20*time.Millisecond {
+		t.Errorf("orders call = %+v", orders)
+	}
+	if users := gateway.Calls[1]; users.Name != "GET users:8080/topology" || users.Timeout != defaultCallTimeout {
+		t.Errorf("users call defaults = %+v", users)
+	}
+	if cfg.Services["users"].Mode != Sequential {
+		t.Errorf("users mode = %q, want the sequential default", cfg.Services["users"].Mode)
+	}
+
+	invalid := []struct {
+		name    string
+		content string
+	}{
+		{name: "mode", content: "services:\n  a:\n    mode: random\n"},
+		{name: "url", content: "services:\n  a:\n    calls:\n      - url: orders:8080\n"},
+		{name: "error rate", content: "services:\n  a:\n    calls:\n      - url: http://b\n        error_rate: 2\n"},
+		{name: "latency", content: "services:\n  a:\n    calls:\n      - url: http://b\n        latency:\n          distribution: pareto\n"},
+	}
+	for _, tt := range invalid {
+		if _, err := LoadConfig(write(tt.name+".yaml", tt.content)); err == nil {
+			t.Errorf("LoadConfig() with invalid %s: expected an error", tt.name)
+		}
+	}
+
+	if cfg, err := LoadConfig(""); err != nil || len(cfg.Services) != 0 {
+		t.Errorf("LoadConfig(\"\") = %+v, %v, want an empty topology", cfg, err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		if r.Method == http.MethodPost && (string(body) != "payload" || r.Header.Get("X-Tenant") != "demo") {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer downstream.Close()
+
+	tests := []struct {
+		name            string
+		service         Service
+		random          float64
+		wantStatus      int
+		wantErrors      []bool
+		wantMaxInFlight int32
+	}{
+		{
+			name: "should call sequentially",
+			service: Service{Mode: Sequential, Calls: []Call{
+				{Name: "a", Method: http.MethodGet, URL: downstream.URL + "/a"},
+				{Name: "b", Method: http.MethodPost, URL: downstream.URL + "/b", Body: "payload", Headers: map[string]string{"X-Tenant": "demo"}},
+			}},
+			random:          1,
+			wantStatus:      http.StatusOK,
+			wantErrors:      []bool{false, false},
+			wantMaxInFlight: 1,
+		},
+		{
+			name: "should fan out in parallel",
+			service: Service{Mode: Parallel, Calls: []Call{
+				{Name: "a", Method: http.MethodGet, URL: downstream.URL + "/a"},
+				{Name: "b", Method: http.MethodGet, URL: downstream.URL + "/b"},
+				{Name: "c", Method: http.MethodGet, URL: downstream.URL + "/c"},
+			}},
+			random:          1,
+			wantStatus:      http.StatusOK,
+			wantErrors:      []bool{false, false, false},
+			wantMaxInFlight: 3,
+		},
+		{
+			name: "should fail with 502 when a downstream fails",
+			service: Service{Mode: Sequential, Calls: []Call{
+				{Name: "fail", Method: http.MethodGet, URL: downstream.URL + "/fail"},
+			}},
+			random:          1,
+			wantStatus:      http.StatusBadGateway,
+			wantErrors:      []bool{true},
+			wantMaxInFlight: 1,
+		},
+		{
+			name: "should inject errors without calling",
+			service: Service{Mode: Sequential, Calls: []Call{
+				{Name: "a", Method: http.MethodGet, URL: downstream.URL + "/a", ErrorRate: 0.5},
+			}},
+			random:     0.1,
+			wantStatus: http.StatusBadGateway,
+			wantErrors: []bool{true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxInFlight.Store(0)
+			for i := range tt.service.Calls {
+				tt.service.Calls[i].Timeout = time.Second
+				tt.service.Calls[i].Latency = &chaos.Latency{Distribution: chaos.Fixed, Value: time.Millisecond}
+			}
+			h := NewHandler("gateway", tt.service)
+			h.random = func() float64 { return tt.random }
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/topology", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			var resp Response
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Service != "gateway" || len(resp.Calls) != len(tt.wantErrors) {
+				t.Fatalf("response = %+v", resp)
+			}
+			for i, call := range resp.Calls {
+				if (call.Error != "") != tt.wantErrors[i] {
+					t.Errorf("call %s error = %q, want error %v", call.Name, call.Error, tt.wantErrors[i])
+				}
+				if call.DurationMs < 1 {
+					t.Errorf("call %s duration = %vms, want the injected latency", call.Name, call.DurationMs)
+				}
+			}
+			if got := maxInFlight.Load(); got != tt.wantMaxInFlight {
+				t.Errorf("max in-flight calls = %d, want %d", got, tt.wantMaxInFlight)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package web
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// namedColors is the CSS named color set accepted as BACKGROUND_COLOR
+var namedColors = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`
+		aliceblue antiquewhite aqua aquamarine azure beige bisque black
+		blanchedalmond blue blueviolet brown burlywood cadetblue chartreuse
+		chocolate coral cornflowerblue cornsilk crimson cyan darkblue darkcyan
+		darkgoldenrod darkgray darkgreen darkgrey darkkhaki darkmagenta
+		darkolivegreen darkorange darkorchid darkred darksalmon darkseagreen
+		darkslateblue darkslategray darkslategrey darkturquoise darkviolet
+		deeppink deepskyblue dimgray dimgrey dodgerblue firebrick floralwhite
+		forestgreen fuchsia gainsboro ghostwhite gold goldenrod gray green
+		greenyellow grey honeydew hotpink indianred indigo ivory khaki lavender
+		lavenderblush lawngreen lemonchiffon lightblue lightcoral lightcyan
+		lightgoldenrodyellow lightgray lightgreen lightgrey lightpink
+		lightsalmon lightseagreen lightskyblue lightslategray lightslategrey
+		lightsteelblue lightyellow lime limegreen linen magenta maroon
+		mediumaquamarine mediumblue mediumorchid mediumpurple mediumseagreen
+		mediumslateblue mediumspringgreen mediumturquoise mediumvioletred
+		midnightblue mintcream mistyrose moccasin navajowhite navy oldlace olive
+		olivedrab orange orangered orchid palegoldenrod palegreen
+		paleturquoise palevioletred papayawhip peachpuff peru pink plum
+		powderblue purple rebeccapurple red rosybrown royalblue saddlebrown
+		salmon sandybrown seagreen seashell sienna silver skyblue slateblue
+		slategray slategrey snow springgreen steelblue tan teal thistle tomato
+		transparent turquoise violet wheat white whitesmoke yellow yellowgreen`) {
+		namedColors[name] = true
+	}
+}
+
+// ValidateColor accepts an empty value, a CSS named color or a hex color,
+// so the value can be written into the page style as is
+func ValidateColor(color string) error {
+	if color == "" || namedColors[strings.ToLower(color)] || hexColor.MatchString(color) {
+		return nil
+	}
+	return fmt.Errorf("invalid BACKGROUND_COLOR %q: must be a CSS named color or a hex color such as #1e90ff", color)
+}
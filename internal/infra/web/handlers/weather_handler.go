@@ -1,36 +1,53 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"github.com/go-chi/chi/v5"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/auth"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/httpclient"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/keypool"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/quota"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/tlsconfig"
 	"github.com/samucadutra/lab-otel-goexpert/internal/usecase"
 	"github.com/samucadutra/lab-otel-goexpert/internal/usecase/servico_a_usecase"
 	"github.com/samucadutra/lab-otel-goexpert/internal/usecase/servico_b_usecase"
-	"github.com/spf13/viper"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 	"net/http"
-	"time"
 )
 
 type WeatherHandler struct {
 	ServicoBUseCase usecase.ServicoBWeatherUseCaseInterface
-	tracer          trace.Tracer
+	// servicoB is the client servico-a calls servico-b with
+	servicoB *httpclient.Client
+	tracer   trace.Tracer
+	// spanName names the server spans, REQUEST_NAME_OTEL
+	spanName string
 }
 
 type WeatherRequest struct {
 	ZipCode interface{} `json:"cep"`
 }
 
-func NewWeatherHandler(tracer trace.Tracer) *WeatherHandler {
-	apiKey := viper.GetString("WEATHER_API_KEY")
+func NewWeatherHandler(tracer trace.Tracer, spanName string, servicoB *httpclient.Client, weatherAPIKeys *keypool.Pool, weatherAPIQuota *quota.Limiter) *WeatherHandler {
 	return &WeatherHandler{
-		ServicoBUseCase: servico_b_usecase.NewServicoBUseCase(apiKey),
+		ServicoBUseCase: servico_b_usecase.NewServicoBUseCase(weatherAPIKeys, weatherAPIQuota),
+		servicoB:        servicoB,
 		tracer:          tracer,
+		spanName:        spanName,
 	}
 }
 
+// requestAttributes describes the TLS peer and the authenticated principal
+// of r
+func requestAttributes(r *http.Request) []attribute.KeyValue {
+	return append(tlsconfig.PeerAttributes(r.TLS), auth.Attributes(r.Context())...)
+}
+
 func (h *WeatherHandler) ProcessServicoA(w http.ResponseWriter, r *http.Request) {
 	var request WeatherRequest
 
@@ -40,16 +57,15 @@ func (h *WeatherHandler) ProcessServicoA(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	servicoAUC := servico_a_usecase.NewServicoAUseCase(request.ZipCode)
+	servicoAUC := servico_a_usecase.NewServicoAUseCase(request.ZipCode, h.servicoB)
 
 	carrier := propagation.HeaderCarrier(r.Header)
 	ctx := r.Context()
 	ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
-	ctx, span := h.tracer.Start(ctx, viper.GetString("REQUEST_NAME_OTEL"))
+	ctx, span := h.tracer.Start(ctx, h.spanName,
+		trace.WithAttributes(requestAttributes(r)...))
 	defer span.End()
 
-	time.Sleep(time.Second * 2)
-
 	response, isValid, err := servicoAUC.Execute(ctx)
 	if err != nil && !isValid {
 		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
@@ -57,7 +73,15 @@ func (h *WeatherHandler) ProcessServicoA(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err != nil {
-		if err.Error() == "can not find zipcode" {
+		var unavailable *servico_a_usecase.UnavailableError
+		if errors.As(err, &unavailable) {
+			if unavailable.RetryAfter != "" {
+				w.Header().Set("Retry-After", unavailable.RetryAfter)
+			}
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		} else if err.Error() == "can not find zipcode" {
 			http.Error(w, err.Error(), http.StatusNotFound)
 		} else {
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -73,14 +97,23 @@ func (h *WeatherHandler) ProcessServicoB(w http.ResponseWriter, r *http.Request)
 	carrier := propagation.HeaderCarrier(r.Header)
 	ctx := r.Context()
 	ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
-	ctx, span := h.tracer.Start(ctx, viper.GetString("REQUEST_NAME_OTEL"))
+	ctx, span := h.tracer.Start(ctx, h.spanName,
+		trace.WithAttributes(requestAttributes(r)...))
 	defer span.End()
 
 	zipcode := chi.URLParam(r, "zipcode")
 
-	response, err := h.ServicoBUseCase.Execute(zipcode)
+	response, err := h.ServicoBUseCase.Execute(ctx, zipcode)
 	if err != nil {
-		if err.Error() == "can not find zipcode" {
+		var exhausted *quota.ExhaustedError
+		if errors.As(err, &exhausted) {
+			w.Header().Set("Retry-After", exhausted.RetryAfterSeconds())
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		} else if errors.Is(err, servico_b_usecase.ErrInvalidZipCode) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		} else if err.Error() == "can not find zipcode" {
 			http.Error(w, err.Error(), http.StatusNotFound)
 		} else {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -4,21 +4,31 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/quota"
+	"github.com/samucadutra/lab-otel-goexpert/internal/usecase/servico_a_usecase"
+	"github.com/samucadutra/lab-otel-goexpert/internal/usecase/servico_b_usecase"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
+var testTracer = noop.NewTracerProvider().Tracer("test")
+
 // Mock implementation of the ServicoBUseCase interface
 type MockWeatherUseCase struct {
-	ExecuteFn      func(zipcode string) (map[string]float64, error)
+	ExecuteFn      func(zipcode string) (*servico_b_usecase.WeatherOutput, error)
 	ExecuteCalled  bool
 	ExecuteZipcode string
 }
 
-func (m *MockWeatherUseCase) Execute(zipcode string) (map[string]float64, error) {
+func (m *MockWeatherUseCase) Execute(ctx context.Context, zipcode string) (*servico_b_usecase.WeatherOutput, error) {
 	m.ExecuteCalled = true
 	m.ExecuteZipcode = zipcode
 	return m.ExecuteFn(zipcode)
@@ -27,11 +37,12 @@ func (m *MockWeatherUseCase) Execute(zipcode string) (map[string]float64, error)
 func TestWeatherHandler_GetWeather_Success(t *testing.T) {
 	// Setup mock
 	mockUseCase := &MockWeatherUseCase{
-		ExecuteFn: func(zipcode string) (map[string]float64, error) {
-			return map[string]float64{
-				"temp_C": 25.0,
-				"temp_F": 77.0,
-				"temp_K": 298.15,
+		ExecuteFn: func(zipcode string) (*servico_b_usecase.WeatherOutput, error) {
+			return &servico_b_usecase.WeatherOutput{
+				UF:    "SP",
+				TempC: 25.0,
+				TempF: 77.0,
+				TempK: 298.15,
 			}, nil
 		},
 	}
@@ -39,6 +50,7 @@ func TestWeatherHandler_GetWeather_Success(t *testing.T) {
 	// Create handler with mock
 	handler := &WeatherHandler{
 		ServicoBUseCase: mockUseCase,
+		tracer:          testTracer,
 	}
 
 	// Setup request
@@ -65,14 +77,17 @@ func TestWeatherHandler_GetWeather_Success(t *testing.T) {
 	}
 
 	// Verify response body
-	var response map[string]float64
+	var response servico_b_usecase.WeatherOutput
 	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
 		t.Errorf("failed to unmarshal response body: %v", err)
 	}
 
 	expectedTemp := 25.0
-	if response["temp_C"] != expectedTemp {
-		t.Errorf("expected temp_C %f, got %f", expectedTemp, response["temp_C"])
+	if response.TempC != expectedTemp {
+		t.Errorf("expected temp_C %f, got %f", expectedTemp, response.TempC)
+	}
+	if response.UF != "SP" {
+		t.Errorf("expected uf %s, got %s", "SP", response.UF)
 	}
 
 	// Verify mock was called with correct arguments
@@ -87,7 +102,7 @@ func TestWeatherHandler_GetWeather_Success(t *testing.T) {
 func TestWeatherHandler_GetWeather_Error(t *testing.T) {
 	// Setup mock with error
 	mockUseCase := &MockWeatherUseCase{
-		ExecuteFn: func(zipcode string) (map[string]float64, error) {
+		ExecuteFn: func(zipcode string) (*servico_b_usecase.WeatherOutput, error) {
 			return nil, errors.New("invalid zipcode")
 		},
 	}
@@ -95,6 +110,7 @@ func TestWeatherHandler_GetWeather_Error(t *testing.T) {
 	// Create handler with mock
 	handler := &WeatherHandler{
 		ServicoBUseCase: mockUseCase,
+		tracer:          testTracer,
 	}
 
 	// Setup request
@@ -121,8 +137,7 @@ func TestWeatherHandler_GetWeather_Error(t *testing.T) {
 }
 
 func TestNewWeatherHandler(t *testing.T) {
-	apiKey := "test-api-key"
-	handler := NewWeatherHandler(apiKey)
+	handler := NewWeatherHandler(testTracer, "test-request", nil, nil, nil)
 
 	if handler == nil {
 		t.Error("expected non-nil handler")
@@ -133,3 +148,115 @@ func TestNewWeatherHandler(t *testing.T) {
 		t.Error("expected non-nil ServicoBUseCase")
 	}
 }
+
+func TestWeatherHandler_GetWeather_DeadlineExceeded(t *testing.T) {
+	mockUseCase := &MockWeatherUseCase{
+		ExecuteFn: func(zipcode string) (*servico_b_usecase.WeatherOutput, error) {
+			return nil, fmt.Errorf("failed to fetch weather data: %w", context.DeadlineExceeded)
+		},
+	}
+
+	handler := &WeatherHandler{
+		ServicoBUseCase: mockUseCase,
+		tracer:          testTracer,
+	}
+
+	req := httptest.NewRequest("GET", "/weather/12345678", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("zipcode", "12345678")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	handler.ProcessServicoB(w, req)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status code %d, got %d", http.StatusGatewayTimeout, w.Code)
+	}
+}
+
+func TestWeatherHandler_GetWeather_QuotaExhausted(t *testing.T) {
+	mockUseCase := &MockWeatherUseCase{
+		ExecuteFn: func(zipcode string) (*servico_b_usecase.WeatherOutput, error) {
+			return nil, fmt.Errorf("failed to fetch weather data: %w",
+				&quota.ExhaustedError{Name: "weatherapi", Reason: quota.ReasonUpstream, RetryAfter: 30 * time.Second})
+		},
+	}
+
+	handler := &WeatherHandler{
+		ServicoBUseCase: mockUseCase,
+		tracer:          testTracer,
+	}
+
+	req := httptest.NewRequest("GET", "/weather/12345678", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("zipcode", "12345678")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	handler.ProcessServicoB(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("expected Retry-After 30, got %q", got)
+	}
+	if !strings.Contains(w.Body.String(), "throttled by the upstream") {
+		t.Errorf("expected the reason in the body, got %q", w.Body.String())
+	}
+}
+
+func TestWeatherHandler_ProcessServicoA_Unavailable(t *testing.T) {
+	servicoB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "weatherapi quota exhausted: throttled by the upstream, retry in 30s", http.StatusServiceUnavailable)
+	}))
+	defer servicoB.Close()
+
+	cfg := configs.Default().ServicoB
+	cfg.URL = servicoB.URL
+	client, err := servico_a_usecase.NewServicoBClient(cfg)
+	if err != nil {
+		t.Fatalf("NewServicoBClient() error = %v", err)
+	}
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer client.Close()
+
+	handler := &WeatherHandler{servicoB: client, tracer: testTracer}
+	w := httptest.NewRecorder()
+	handler.ProcessServicoA(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"cep": "01001000"}`)))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("expected Retry-After 30, got %q", got)
+	}
+	if !strings.Contains(w.Body.String(), "throttled by the upstream") {
+		t.Errorf("expected the reason in the body, got %q", w.Body.String())
+	}
+}
+
+func TestWeatherHandler_GetWeather_UnallocatedZipCode(t *testing.T) {
+	handler := &WeatherHandler{
+		ServicoBUseCase: servico_b_usecase.NewServicoBUseCase(nil, nil),
+		tracer:          testTracer,
+	}
+
+	req := httptest.NewRequest("GET", "/00000000", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("zipcode", "00000000")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	handler.ProcessServicoB(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status code %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "invalid zipcode") {
+		t.Errorf("expected invalid zipcode in the body, got %q", w.Body.String())
+	}
+}
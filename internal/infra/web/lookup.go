@@ -0,0 +1,108 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// lookupTimeout bounds the call made to servico-a for a CEP typed on the page
+const lookupTimeout = 10 * time.Second
+
+// TraceIDPlaceholder is replaced by the trace ID in TemplateData.TracingUIURL
+const TraceIDPlaceholder = "{trace_id}"
+
+// lookupResult is the outcome of a CEP lookup shown on the page
+type lookupResult struct {
+	CEP   string
+	City  string
+	UF    string
+	TempC float64
+	TempF float64
+	TempK float64
+	// Error is a message meant for the user, empty on success
+	Error string
+}
+
+// lookup submits zipcode to servico-a and turns its answer into a result
+// the page can show, with errors in a friendly form
+func (h *Page) lookup(ctx context.Context, zipcode string) *lookupResult {
+	// accept the usual 00000-000 notation
+	zipcode = strings.NewReplacer("-", "", ".", "", " ", "").Replace(zipcode)
+	result := &lookupResult{CEP: zipcode}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]string{"cep": zipcode})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.TemplateData.LookupURL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = "The lookup service is misconfigured."
+		return result
+	}
+	for name, values := range h.TemplateData.LookupHeader {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := h.client().Do(req)
+	if err != nil {
+		result.Error = friendlyError(0)
+		if ctx.Err() != nil {
+			result.Error = friendlyError(http.StatusGatewayTimeout)
+		}
+		return result
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		result.Error = friendlyError(resp.StatusCode)
+		return result
+	}
+
+	var data struct {
+		City  string  `json:"city"`
+		UF    string  `json:"uf"`
+		TempC float64 `json:"temp_c"`
+		TempF float64 `json:"temp_f"`
+		TempK float64 `json:"temp_k"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		result.Error = friendlyError(0)
+		return result
+	}
+	result.City, result.UF = data.City, data.UF
+	result.TempC, result.TempF, result.TempK = data.TempC, data.TempF, data.TempK
+	return result
+}
+
+func friendlyError(status int) string {
+	switch status {
+	case http.StatusUnprocessableEntity, http.StatusBadRequest:
+		return "This does not look like a valid CEP. Type its 8 digits, for example 01001-000."
+	case http.StatusNotFound:
+		return "We could not find this CEP. Check the digits and try again."
+	case http.StatusGatewayTimeout:
+		return "The weather service took too long to answer. Please try again in a moment."
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "This page is not allowed to call the weather service. Check its LOOKUP_API_KEY."
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return "The weather service is busy right now. Please try again in a moment."
+	}
+	return "Something went wrong while fetching the weather. Please try again."
+}
+
+// traceURL links a trace ID to the configured tracing UI
+func (h *Page) traceURL(traceID string) string {
+	if h.TemplateData.TracingUIURL == "" {
+		return ""
+	}
+	return strings.ReplaceAll(h.TemplateData.TracingUIURL, TraceIDPlaceholder, traceID)
+}
@@ -0,0 +1,134 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/health"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/httpclient"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/keypool"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/quota"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/topology"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/web/handlers"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Weather is the module serving the weather routes of the role
+type Weather struct {
+	Role   configs.Role
+	Tracer trace.Tracer
+	// SpanName names the server spans, REQUEST_NAME_OTEL
+	SpanName string
+	// ServicoB is the client servico-a calls servico-b with
+	ServicoB *httpclient.Client
+	// WeatherAPIKeys is the key pool used by servico-b
+	WeatherAPIKeys *keypool.Pool
+	// WeatherAPIQuota guards the WeatherAPI calls of servico-b
+	WeatherAPIQuota *quota.Limiter
+}
+
+// Register mounts servico-a and servico-b, as served by the role
+func (m Weather) Register(r *Routes) {
+	weatherHandler := handlers.NewWeatherHandler(m.Tracer, m.SpanName, m.ServicoB, m.WeatherAPIKeys, m.WeatherAPIQuota)
+	if m.Role.ServesA() {
+		r.Method(RouteServicoA, http.MethodPost, "/weather/servico-a", http.HandlerFunc(weatherHandler.ProcessServicoA))
+	}
+	if m.Role.ServesB() {
+		r.Method(RouteServicoB, http.MethodGet, "/weather/servico-b/{zipcode}", http.HandlerFunc(weatherHandler.ProcessServicoB))
+	}
+}
+
+// Admin is the module serving the metrics and the health checks
+type Admin struct {
+	Readiness *health.Readiness
+}
+
+// Register mounts /metrics, which gets the per-route middlewares, and the
+// health checks, which are always public
+func (m Admin) Register(r *Routes) {
+	r.Handle(RouteMetrics, "/metrics", promhttp.Handler())
+	r.Method("", http.MethodGet, "/healthz", http.HandlerFunc(health.Live))
+	r.Method("", http.MethodGet, "/readyz", http.HandlerFunc(m.Readiness.Handler))
+}
+
+// Liveness is the module serving only /healthz, kept on the public port when
+// the admin routes move to their own listener, since servico-a probes the
+// servico-b instances there
+type Liveness struct{}
+
+// Register mounts /healthz, which is always public
+func (Liveness) Register(r *Routes) {
+	r.Method("", http.MethodGet, "/healthz", http.HandlerFunc(health.Live))
+}
+
+// Debug is the module serving the profiler, the build info and the effective
+// configuration, meant for the admin listener only
+type Debug struct {
+	// Values returns the settings in use, which change on reload
+	Values func() []configs.EffectiveValue
+}
+
+// Register mounts net/http/pprof on /debug/pprof, /debug/buildinfo and
+// /debug/config
+func (m Debug) Register(r *Routes) {
+	r.Handle(RouteDebug, "/debug/pprof/*", http.HandlerFunc(pprof.Index))
+	r.Handle(RouteDebug, "/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+	r.Handle(RouteDebug, "/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	r.Handle(RouteDebug, "/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	r.Handle(RouteDebug, "/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+	r.Method(RouteDebug, http.MethodGet, "/debug/buildinfo", http.HandlerFunc(buildInfo))
+	if m.Values != nil {
+		r.Method(RouteDebug, http.MethodGet, "/debug/config", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			values := make(map[string]string)
+			for _, v := range m.Values() {
+				values[v.Key] = v.Value
+			}
+			writeJSON(w, values)
+		}))
+	}
+}
+
+// buildInfo reports the Go version, the module version and the VCS revision
+// the binary was built from
+func buildInfo(w http.ResponseWriter, r *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		http.Error(w, "build info not available", http.StatusNotFound)
+		return
+	}
+	body := map[string]string{
+		"go_version": info.GoVersion,
+		"path":       info.Main.Path,
+		"version":    info.Main.Version,
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision", "vcs.time", "vcs.modified", "GOOS", "GOARCH":
+			body[s.Key] = s.Value
+		}
+	}
+	writeJSON(w, body)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// Topology is the module serving the simulated downstream calls on /topology
+type Topology struct {
+	Handler *topology.Handler
+}
+
+// Register mounts /topology when a topology is configured
+func (m Topology) Register(r *Routes) {
+	if m.Handler != nil {
+		r.Handle(RouteTopology, "/topology", m.Handler)
+	}
+}
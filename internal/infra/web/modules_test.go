@@ -0,0 +1,50 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+)
+
+func TestDebug(t *testing.T) {
+	cfg := configs.Default()
+	s := NewServer("")
+	s.Group().Mount(Debug{Values: cfg.Effective})
+	handler := s.Handler()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantKey    string
+		wantValue  string
+	}{
+		{name: "should report the Go version", path: "/debug/buildinfo", wantStatus: http.StatusOK, wantKey: "go_version"},
+		{name: "should report the effective config", path: "/debug/config", wantStatus: http.StatusOK, wantKey: "ADMIN_PORT", wantValue: "127.0.0.1:9090"},
+		{name: "should serve the profiler index", path: "/debug/pprof/", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantKey == "" {
+				return
+			}
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			got, ok := body[tt.wantKey]
+			if !ok || (tt.wantValue != "" && got != tt.wantValue) {
+				t.Errorf("%s = %q, want %q", tt.wantKey, got, tt.wantValue)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package web
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/auth"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//go:embed template/*
+var templateContent embed.FS
+
+// Page is the UI module serving the index page on /
+type Page struct {
+	TemplateData *TemplateData
+}
+
+// NewPage creates the index page rendering templateData
+func NewPage(templateData *TemplateData) *Page {
+	return &Page{TemplateData: templateData}
+}
+
+// Register mounts the index page
+func (h *Page) Register(r *Routes) {
+	r.Method(RouteIndex, http.MethodGet, "/", http.HandlerFunc(h.HandleRequest))
+}
+
+// externalCallTimeout bounds the call made to ExternalCallURL, so a slow
+// upstream does not hold the page until the router timeout
+var externalCallTimeout = 10 * time.Second
+
+// indexTemplate is parsed once and shared by every request
+var indexTemplate = template.Must(template.New("index.html").ParseFS(templateContent, "template/index.html"))
+
+// TemplateData holds the page settings shared by every request. It must not
+// be written to while serving; per-request values go into pageData.
+type TemplateData struct {
+	Title              string
+	BackgroundColor    string
+	ExternalCallMethod string
+	// ExternalCallURL is a single URL whose answer is shown on the page,
+	// PAGE_EXTERNAL_CALL_URL
+	ExternalCallURL string
+	// LookupURL is the servico-a endpoint the CEP form is submitted to; the
+	// form is hidden when empty
+	LookupURL string
+	// LookupClient submits the form to LookupURL and calls ExternalCallURL,
+	// e.g. with the CA and the client certificate of a TLS servico-a; nil
+	// uses http.DefaultClient
+	LookupClient *http.Client
+	// LookupHeader is sent with every lookup, e.g. the API key servico-a
+	// requires
+	LookupHeader http.Header
+	// TracingUIURL links trace IDs to the tracing UI, with TraceIDPlaceholder
+	// standing for the trace ID
+	TracingUIURL    string
+	RequestNameOTEL string
+	OTELTracer      trace.Tracer
+}
+
+// pageData is the view rendered for a single request
+type pageData struct {
+	Title           string
+	BackgroundColor string
+	LookupEnabled   bool
+	Lookup          *lookupResult
+	TraceID         string
+	TraceURL        string
+	// Fields holds the upstream response when it is a JSON object
+	Fields []field
+	// Content holds any other upstream response, rendered as escaped text
+	Content string
+}
+
+type field struct {
+	Name  string
+	Value string
+}
+
+// parseContent splits a JSON object into fields sorted by name, falling back
+// to the raw body for anything else
+func parseContent(body string) ([]field, string) {
+	var object map[string]any
+	if err := json.Unmarshal([]byte(body), &object); err != nil || object == nil {
+		return nil, body
+	}
+
+	fields := make([]field, 0, len(object))
+	for name, value := range object {
+		text, ok := value.(string)
+		if !ok {
+			encoded, _ := json.Marshal(value)
+			text = string(encoded)
+		}
+		fields = append(fields, field{Name: name, Value: text})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields, ""
+}
+
+func (h *Page) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	carrier := propagation.HeaderCarrier(r.Header)
+	ctx := r.Context()
+	ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
+	ctx, span := h.TemplateData.OTELTracer.Start(ctx, h.TemplateData.RequestNameOTEL,
+		trace.WithAttributes(auth.Attributes(r.Context())...))
+	defer span.End()
+
+	page := pageData{
+		Title:           h.TemplateData.Title,
+		BackgroundColor: h.TemplateData.BackgroundColor,
+		LookupEnabled:   h.TemplateData.LookupURL != "",
+	}
+	if zipcode := r.URL.Query().Get("cep"); zipcode != "" && page.LookupEnabled {
+		page.Lookup = h.lookup(ctx, zipcode)
+		if sc := span.SpanContext(); sc.HasTraceID() {
+			page.TraceID = sc.TraceID().String()
+			page.TraceURL = h.traceURL(page.TraceID)
+		}
+	}
+	if h.TemplateData.ExternalCallURL != "" {
+		content, status, err := h.callExternal(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		page.Fields, page.Content = parseContent(content)
+	}
+
+	err := indexTemplate.Execute(w, page)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error executing template: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// client is the LookupClient, or http.DefaultClient when not set
+func (h *Page) client() *http.Client {
+	if h.TemplateData.LookupClient != nil {
+		return h.TemplateData.LookupClient
+	}
+	return http.DefaultClient
+}
+
+// callExternal calls the configured external URL and returns its body, or
+// the status to answer with when the call fails
+func (h *Page) callExternal(ctx context.Context) (string, int, error) {
+	method := h.TemplateData.ExternalCallMethod
+	if method != http.MethodGet && method != http.MethodPost {
+		return "", http.StatusInternalServerError, fmt.Errorf("Invalid ExternalCallMethod")
+	}
+	ctx, cancel := context.WithTimeout(ctx, externalCallTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, h.TemplateData.ExternalCallURL, nil)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := h.client().Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", http.StatusGatewayTimeout, err
+		}
+		return "", http.StatusInternalServerError, err
+	}
+	defer resp.Body.Close()
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	return string(bodyBytes), http.StatusOK, nil
+}
@@ -0,0 +1,276 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestPage_HandleRequest_Concurrent(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	// the upstream answers with the trace ID it received, which is the one
+	// of the request that triggered the call
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		fmt.Fprintf(w, "upstream-%s", trace.SpanContextFromContext(ctx).TraceID())
+	}))
+	defer upstream.Close()
+
+	page := NewPage(&TemplateData{
+		Title:              "Microservice",
+		ExternalCallMethod: http.MethodGet,
+		ExternalCallURL:    upstream.URL,
+		RequestNameOTEL:    "index",
+		OTELTracer:         noop.NewTracerProvider().Tracer("test"),
+	})
+
+	const requests = 50
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			traceID := fmt.Sprintf("%032x", i+1)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("traceparent", fmt.Sprintf("00-%s-00f067aa0ba902b7-01", traceID))
+			w := httptest.NewRecorder()
+			page.HandleRequest(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("request %d: status = %d", i, w.Code)
+				return
+			}
+			body := w.Body.String()
+			if strings.Count(body, "upstream-") != 1 || !strings.Contains(body, "upstream-"+traceID) {
+				t.Errorf("request %d rendered another request's content: %s", i, body)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPage_HandleRequest_InvalidMethod(t *testing.T) {
+	page := NewPage(&TemplateData{
+		ExternalCallMethod: http.MethodDelete,
+		ExternalCallURL:    "http://localhost:0",
+		OTELTracer:         noop.NewTracerProvider().Tracer("test"),
+	})
+
+	w := httptest.NewRecorder()
+	page.HandleRequest(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestPage_HandleRequest_SlowUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	defer func(timeout time.Duration) { externalCallTimeout = timeout }(externalCallTimeout)
+	externalCallTimeout = 20 * time.Millisecond
+
+	page := NewPage(&TemplateData{
+		ExternalCallMethod: http.MethodGet,
+		ExternalCallURL:    upstream.URL,
+		OTELTracer:         noop.NewTracerProvider().Tracer("test"),
+	})
+
+	w := httptest.NewRecorder()
+	page.HandleRequest(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+}
+
+func TestPage_HandleRequest_Content(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream string
+		want     []string
+		notWant  []string
+	}{
+		{
+			name:     "should escape upstream markup",
+			upstream: `<script>alert(1)</script>`,
+			want:     []string{"&lt;script&gt;alert(1)&lt;/script&gt;"},
+			notWant:  []string{"<script>"},
+		},
+		{
+			name:     "should render a JSON object as fields",
+			upstream: `{"uf":"SP","temp_C":28.5,"city":"<b>São Paulo</b>"}`,
+			want:     []string{"<dt>city</dt>", "<dd>&lt;b&gt;São Paulo&lt;/b&gt;</dd>", "<dt>temp_C</dt>", "<dd>28.5</dd>", "<dd>SP</dd>"},
+			notWant:  []string{"<b>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tt.upstream)
+			}))
+			defer upstream.Close()
+
+			page := NewPage(&TemplateData{
+				BackgroundColor:    "white",
+				ExternalCallMethod: http.MethodGet,
+				ExternalCallURL:    upstream.URL,
+				OTELTracer:         noop.NewTracerProvider().Tracer("test"),
+			})
+
+			w := httptest.NewRecorder()
+			page.HandleRequest(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			body := w.Body.String()
+			for _, s := range tt.want {
+				if !strings.Contains(body, s) {
+					t.Errorf("body does not contain %q:\n%s", s, body)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(body, s) {
+					t.Errorf("body contains %q:\n%s", s, body)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateColor(t *testing.T) {
+	tests := []struct {
+		color   string
+		wantErr bool
+	}{
+		{color: ""},
+		{color: "white"},
+		{color: "DodgerBlue"},
+		{color: "#fff"},
+		{color: "#1e90ff80"},
+		{color: "#12345", wantErr: true},
+		{color: "red; } body { display: none", wantErr: true},
+		{color: "url(javascript:alert(1))", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateColor(tt.color); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateColor(%q) error = %v, wantErr %v", tt.color, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPage_HandleRequest_Lookup(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	// a self-signed servico-a: only the configured client trusts it
+	servicoA := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "s3cret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			CEP string `json:"cep"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch body.CEP {
+		case "01001000":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"city":"São Paulo","uf":"SP","temp_c":25,"temp_f":77,"temp_k":298.15}`)
+		case "99999999":
+			http.Error(w, "can not find zipcode", http.StatusNotFound)
+		default:
+			http.Error(w, "invalid zipcode", http.StatusUnprocessableEntity)
+		}
+	}))
+	defer servicoA.Close()
+
+	page := NewPage(&TemplateData{
+		LookupURL:    servicoA.URL,
+		LookupClient: servicoA.Client(),
+		LookupHeader: http.Header{"X-Api-Key": {"s3cret"}},
+		TracingUIURL: "http://zipkin.local/zipkin/traces/" + TraceIDPlaceholder,
+		OTELTracer:   noop.NewTracerProvider().Tracer("test"),
+	})
+	withoutKey := NewPage(&TemplateData{
+		LookupURL:    servicoA.URL,
+		LookupClient: servicoA.Client(),
+		OTELTracer:   noop.NewTracerProvider().Tracer("test"),
+	})
+
+	tests := []struct {
+		name    string
+		page    *Page
+		query   string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "should show only the form without a CEP",
+			query:   "",
+			want:    []string{`<form method="get" action="/">`},
+			notWant: []string{"Trace ID"},
+		},
+		{
+			name:  "should show the city, state and temperatures",
+			query: "?cep=01001-000",
+			want: []string{
+				"São Paulo / SP", "25.0 &deg;C", "77.0 &deg;F", "298.15 K", `value="01001000"`,
+				`<a href="http://zipkin.local/zipkin/traces/4bf92f3577b34da6a3ce929d0e0e4736"`,
+			},
+		},
+		{
+			name:    "should explain an unknown CEP",
+			query:   "?cep=99999999",
+			want:    []string{"We could not find this CEP", "4bf92f3577b34da6a3ce929d0e0e4736"},
+			notWant: []string{"can not find zipcode"},
+		},
+		{
+			name:  "should explain an invalid CEP",
+			query: "?cep=123",
+			want:  []string{"This does not look like a valid CEP"},
+		},
+		{
+			name:    "should explain a rejected credential",
+			page:    withoutKey,
+			query:   "?cep=01001000",
+			want:    []string{"not allowed to call the weather service"},
+			notWant: []string{"Something went wrong"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			w := httptest.NewRecorder()
+			if tt.page != nil {
+				tt.page.HandleRequest(w, req)
+			} else {
+				page.HandleRequest(w, req)
+			}
+
+			body := w.Body.String()
+			for _, s := range tt.want {
+				if !strings.Contains(body, s) {
+					t.Errorf("body does not contain %q:\n%s", s, body)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(body, s) {
+					t.Errorf("body contains %q:\n%s", s, body)
+				}
+			}
+		})
+	}
+}
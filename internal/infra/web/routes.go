@@ -0,0 +1,99 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Route names used to configure per-route middlewares such as fault injection
+// rate limiting and authentication
+const (
+	RouteServicoA = "servico-a"
+	RouteServicoB = "servico-b"
+	RouteIndex    = "index"
+	RouteTopology = "topology"
+	RouteMetrics  = "metrics"
+	RouteDebug    = "debug"
+)
+
+// Middleware wraps every route of a server or group
+type Middleware = func(http.Handler) http.Handler
+
+// RouteMiddleware builds the middleware of a named route, like the Route
+// methods of the rate limiter, authenticator and fault injector
+type RouteMiddleware = func(route string) func(http.Handler) http.Handler
+
+// Module plugs a set of routes into a group
+type Module interface {
+	Register(r *Routes)
+}
+
+// ModuleFunc adapts a function to a Module
+type ModuleFunc func(r *Routes)
+
+func (f ModuleFunc) Register(r *Routes) { f(r) }
+
+// Group is a set of modules sharing a middleware stack
+type Group struct {
+	middleware []Middleware
+	perRoute   []RouteMiddleware
+	modules    []Module
+}
+
+// Use appends middlewares run on every route of the group
+func (g *Group) Use(middleware ...Middleware) *Group {
+	g.middleware = append(g.middleware, middleware...)
+	return g
+}
+
+// UseRoute appends middlewares built for each named route of the group
+func (g *Group) UseRoute(middleware ...RouteMiddleware) *Group {
+	g.perRoute = append(g.perRoute, middleware...)
+	return g
+}
+
+// Mount adds modules to the group
+func (g *Group) Mount(modules ...Module) *Group {
+	g.modules = append(g.modules, modules...)
+	return g
+}
+
+// Routes is handed to the modules to register their routes
+type Routes struct {
+	router   chi.Router
+	perRoute []RouteMiddleware
+}
+
+// Handle registers h on pattern for every method. Routes with a name get the
+// per-route middlewares of the group; unnamed routes skip them.
+func (r *Routes) Handle(name, pattern string, h http.Handler) {
+	r.with(name).Handle(pattern, h)
+}
+
+// Method registers h on pattern for method, see Handle
+func (r *Routes) Method(name, method, pattern string, h http.Handler) {
+	r.with(name).Method(method, pattern, h)
+}
+
+func (r *Routes) with(name string) chi.Router {
+	if name == "" || len(r.perRoute) == 0 {
+		return r.router
+	}
+	middleware := make([]func(http.Handler) http.Handler, len(r.perRoute))
+	for i, build := range r.perRoute {
+		middleware[i] = build(name)
+	}
+	return r.router.With(middleware...)
+}
+
+// mount registers the modules of g on router
+func (g *Group) mount(router chi.Router) {
+	router.Group(func(router chi.Router) {
+		router.Use(g.middleware...)
+		routes := &Routes{router: router, perRoute: g.perRoute}
+		for _, m := range g.modules {
+			m.Register(routes)
+		}
+	})
+}
@@ -1,110 +1,237 @@
 package web
 
 import (
-	"embed"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"github.com/samucadutra/lab-otel-goexpert/internal/infra/web/handlers"
-	"io"
+	"log"
+	"net"
 	"net/http"
-	"text/template"
+	"runtime/debug"
 	"time"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/trace"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/deadline"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/health"
 )
 
-//go:embed template/*
-var templateContent embed.FS
+// defaultStopTimeout bounds each stop hook
+const defaultStopTimeout = 5 * time.Second
 
-type Webserver struct {
-	TemplateData *TemplateData
+// Hook runs code when the server starts and stops; either function may be nil
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
 }
 
-// NewServer creates a new server instance
-func NewServer(templateData *TemplateData) *Webserver {
-	return &Webserver{
-		TemplateData: templateData,
-	}
+// Server serves the routes registered by modules in groups and runs the
+// start and stop hooks around the listener
+type Server struct {
+	Addr      string
+	TLSConfig *tls.Config
+	// Readiness backs /readyz and is flipped by Run
+	Readiness *health.Readiness
+	// ReadinessDelay is waited between failing readiness and closing the
+	// listener, so load balancers notice first
+	ReadinessDelay time.Duration
+	// GracePeriod bounds the drain of the in-flight requests
+	GracePeriod time.Duration
+	// StopTimeout bounds each stop hook
+	StopTimeout time.Duration
+
+	middleware []Middleware
+	groups     []*Group
+	hooks      []Hook
 }
 
-// CreateServer creates a new server instance with go chi router
-func (we *Webserver) CreateServer() *chi.Mux {
-	router := chi.NewRouter()
+// NewServer creates a server listening on addr with the middlewares shared by
+// every route: request ID, real IP, panic recovery, access log, a 60s
+// timeout and the propagated deadline
+func NewServer(addr string) *Server {
+	s := &Server{
+		Addr:        addr,
+		Readiness:   health.NewReadiness(),
+		StopTimeout: defaultStopTimeout,
+	}
+	s.Use(middleware.RequestID, middleware.RealIP, recoverer, middleware.Logger,
+		middleware.Timeout(60*time.Second), deadline.Middleware)
+	return s
+}
 
-	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.Logger)
-	router.Use(middleware.Timeout(60 * time.Second))
-	// promhttp
-	router.Handle("/metrics", promhttp.Handler())
-	weatherHandler := handlers.NewWeatherHandler(we.TemplateData.OTELTracer)
-	router.Route("/weather", func(r chi.Router) {
-		r.Post("/servico-a", weatherHandler.ProcessServicoA)
-		r.Get("/servico-b/{zipcode}", weatherHandler.ProcessServicoB)
+// recoverer is middleware.Recoverer, except that it panics again with
+// http.ErrAbortHandler instead of answering 200, so handlers such as the
+// fault injector can still abort the connection
+func recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+			log.Printf("panic serving %s: %v\n%s", r.URL.Path, rvr, debug.Stack())
+			w.WriteHeader(http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
 	})
-	router.Get("/", we.HandleRequest)
+}
+
+// Use appends middlewares run on every route of the server
+func (s *Server) Use(middleware ...Middleware) {
+	s.middleware = append(s.middleware, middleware...)
+}
+
+// Group adds a group of routes with its own middleware stack
+func (s *Server) Group() *Group {
+	g := &Group{}
+	s.groups = append(s.groups, g)
+	return g
+}
+
+// Append adds a hook. Start hooks run in order before the listener opens,
+// stop hooks in reverse order once it is closed; a failed stop hook is
+// logged and the next ones still run.
+func (s *Server) Append(hook Hook) {
+	s.hooks = append(s.hooks, hook)
+}
+
+// Handler builds the router with the routes of every group
+func (s *Server) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Use(s.middleware...)
+	for _, g := range s.groups {
+		g.mount(router)
+	}
 	return router
 }
 
-type TemplateData struct {
-	Title              string
-	BackgroundColor    string
-	ResponseTime       time.Duration
-	ExternalCallMethod string
-	ExternalCallURL    string
-	Content            string
-	RequestNameOTEL    string
-	OTELTracer         trace.Tracer
+// Run starts the hooks and serves until ctx is done, then fails readiness,
+// drains the in-flight requests within GracePeriod and stops the hooks
+func (s *Server) Run(ctx context.Context) error {
+	started, err := s.start(ctx)
+	if err != nil {
+		s.stop(started)
+		return err
+	}
+
+	httpServer, serveErr, err := s.listen("server")
+	if err != nil {
+		s.stop(started)
+		return err
+	}
+	s.Readiness.Set(true)
+
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+		err = s.shutdown(httpServer)
+	}
+	s.stop(started)
+	return err
+}
+
+// Serve returns a hook serving s next to the server it is appended to, e.g.
+// an admin listener. The hooks of s are not run and its readiness is left to
+// the other server.
+func (s *Server) Serve(name string) Hook {
+	var httpServer *http.Server
+	return Hook{
+		Name: name,
+		OnStart: func(context.Context) error {
+			var (
+				serveErr <-chan error
+				err      error
+			)
+			httpServer, serveErr, err = s.listen(name)
+			if err != nil {
+				return err
+			}
+			go func() {
+				if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+					log.Printf("%s stopped: %v", name, err)
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			if err := httpServer.Shutdown(ctx); err != nil {
+				return httpServer.Close()
+			}
+			return nil
+		},
+	}
 }
 
-func (h *Webserver) HandleRequest(w http.ResponseWriter, r *http.Request) {
-	carrier := propagation.HeaderCarrier(r.Header)
-	ctx := r.Context()
-	ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
-	ctx, span := h.TemplateData.OTELTracer.Start(ctx, h.TemplateData.RequestNameOTEL)
-	defer span.End()
-
-	time.Sleep(time.Millisecond * h.TemplateData.ResponseTime)
-
-	if h.TemplateData.ExternalCallURL != "" {
-		var req *http.Request
-		var err error
-		if h.TemplateData.ExternalCallMethod == "GET" {
-			req, err = http.NewRequestWithContext(ctx, "GET", h.TemplateData.ExternalCallURL, nil)
-		} else if h.TemplateData.ExternalCallMethod == "POST" {
-			req, err = http.NewRequestWithContext(ctx, "POST", h.TemplateData.ExternalCallURL, nil)
-		} else {
-			http.Error(w, "Invalid ExternalCallMethod", http.StatusInternalServerError)
+// listen opens the listener on Addr, so a port in use fails right away, and
+// serves on it in the background
+func (s *Server) listen(name string) (*http.Server, <-chan error, error) {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpServer := &http.Server{Addr: s.Addr, Handler: s.Handler(), TLSConfig: s.TLSConfig}
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.TLSConfig != nil {
+			log.Printf("Starting TLS %s on %s", name, ln.Addr())
+			// the certificate comes from TLSConfig.GetCertificate
+			serveErr <- httpServer.ServeTLS(ln, "", "")
 			return
 		}
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		log.Printf("Starting %s on %s", name, ln.Addr())
+		serveErr <- httpServer.Serve(ln)
+	}()
+	return httpServer, serveErr, nil
+}
+
+// start runs the start hooks, returning the hooks started so far
+func (s *Server) start(ctx context.Context) ([]Hook, error) {
+	for i, hook := range s.hooks {
+		if hook.OnStart == nil {
+			continue
 		}
-		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if err := hook.OnStart(ctx); err != nil {
+			return s.hooks[:i], fmt.Errorf("%s: %w", hook.Name, err)
 		}
-		defer resp.Body.Close()
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	}
+	return s.hooks, nil
+}
+
+// stop runs the stop hooks of started in reverse order
+func (s *Server) stop(started []Hook) {
+	for i := len(started) - 1; i >= 0; i-- {
+		hook := started[i]
+		if hook.OnStop == nil {
+			continue
 		}
-		h.TemplateData.Content = string(bodyBytes)
+		ctx, cancel := context.WithTimeout(context.Background(), s.StopTimeout)
+		if err := hook.OnStop(ctx); err != nil {
+			log.Printf("failed to stop %s: %v", hook.Name, err)
+		}
+		cancel()
 	}
+}
 
-	tpl := template.Must(template.New("index.html").ParseFS(templateContent, "template/index.html"))
-	err := tpl.Execute(w, h.TemplateData)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error executing template: %v", err), http.StatusInternalServerError)
-		return
+// shutdown fails readiness so load balancers stop sending traffic, then
+// drains the in-flight requests within GracePeriod
+func (s *Server) shutdown(httpServer *http.Server) error {
+	log.Println("Shutting down: readiness is now failing")
+	s.Readiness.Set(false)
+	if s.ReadinessDelay > 0 {
+		time.Sleep(s.ReadinessDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.GracePeriod)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("In-flight requests not drained within %s, closing connections: %v", s.GracePeriod, err)
+		return httpServer.Close()
 	}
+	log.Println("Server stopped")
+	return nil
 }
@@ -0,0 +1,188 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/chaos"
+)
+
+func header(name, value string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add(name, value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestServer_Groups(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	route := func(name string) func(http.Handler) http.Handler { return header("X-Route", name) }
+
+	s := NewServer("")
+	s.Group().Use(header("X-Group", "app")).UseRoute(route).Mount(ModuleFunc(func(r *Routes) {
+		r.Method("named", http.MethodGet, "/named", ok)
+		r.Handle("", "/unnamed", ok)
+	}))
+	s.Group().Use(header("X-Group", "admin")).Mount(ModuleFunc(func(r *Routes) {
+		r.Handle("admin", "/admin", ok)
+	}))
+	handler := s.Handler()
+
+	tests := []struct {
+		path      string
+		wantGroup string
+		wantRoute string
+	}{
+		{path: "/named", wantGroup: "app", wantRoute: "named"},
+		{path: "/unnamed", wantGroup: "app"},
+		{path: "/admin", wantGroup: "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d", w.Code)
+			}
+			if got := w.Header().Values("X-Group"); !reflect.DeepEqual(got, []string{tt.wantGroup}) {
+				t.Errorf("X-Group = %v, want %q", got, tt.wantGroup)
+			}
+			if got := w.Header().Get("X-Route"); got != tt.wantRoute {
+				t.Errorf("X-Route = %q, want %q", got, tt.wantRoute)
+			}
+		})
+	}
+}
+
+func TestServer_Run_Hooks(t *testing.T) {
+	tests := []struct {
+		name     string
+		failing  string
+		wantErr  bool
+		wantCall []string
+	}{
+		{
+			name:     "should start in order and stop in reverse",
+			wantCall: []string{"start a", "start b", "stop b", "stop a"},
+		},
+		{
+			name:     "should stop the started hooks when one fails to start",
+			failing:  "b",
+			wantErr:  true,
+			wantCall: []string{"start a", "start b", "stop a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			s := NewServer("127.0.0.1:0")
+			for _, name := range []string{"a", "b"} {
+				s.Append(Hook{
+					Name: name,
+					OnStart: func(context.Context) error {
+						calls = append(calls, "start "+name)
+						if name == tt.failing {
+							return errors.New("boom")
+						}
+						return nil
+					},
+					OnStop: func(context.Context) error {
+						calls = append(calls, "stop "+name)
+						return nil
+					},
+				})
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := s.Run(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCall) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCall)
+			}
+			if s.Readiness.Ready() {
+				t.Error("readiness still passing after Run returned")
+			}
+		})
+	}
+}
+
+func TestServer_Serve(t *testing.T) {
+	// reserve a free port for the admin listener
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	admin := NewServer(addr)
+	admin.Group().Mount(ModuleFunc(func(r *Routes) {
+		r.Handle("", "/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	}))
+	hook := admin.Serve("admin server")
+
+	if err := hook.OnStart(context.Background()); err != nil {
+		t.Fatalf("OnStart() error = %v", err)
+	}
+	resp, err := http.Get("http://" + addr + "/ping")
+	if err != nil {
+		t.Fatalf("GET /ping error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d", resp.StatusCode)
+	}
+
+	if err := NewServer(addr).Serve("taken").OnStart(context.Background()); err == nil {
+		t.Error("OnStart() on a port in use: want error")
+	}
+
+	if err := hook.OnStop(context.Background()); err != nil {
+		t.Fatalf("OnStop() error = %v", err)
+	}
+	if _, err := http.Get("http://" + addr + "/ping"); err == nil {
+		t.Error("admin server still serving after OnStop")
+	}
+}
+
+func TestServer_Handler_Panics(t *testing.T) {
+	injector := chaos.NewInjector(chaos.Config{Routes: map[string]chaos.Rule{"abort": {AbortRate: 1}}})
+	s := NewServer("")
+	s.Group().UseRoute(injector.Route).Mount(ModuleFunc(func(r *Routes) {
+		ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		r.Handle("abort", "/abort", ok)
+		r.Handle("", "/panic", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+	}))
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	// an injected abort goes through the recoverer and drops the connection
+	if resp, err := http.Get(server.URL + "/abort"); err == nil {
+		resp.Body.Close()
+		t.Errorf("GET /abort status = %d, want the connection aborted", resp.StatusCode)
+	}
+
+	resp, err := http.Get(server.URL + "/panic")
+	if err != nil {
+		t.Fatalf("GET /panic error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("GET /panic status = %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+}
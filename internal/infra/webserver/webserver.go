@@ -1,37 +0,0 @@
-package webserver
-
-import (
-	"fmt"
-	"net/http"
-
-	"github.com/go-chi/chi/v5"
-)
-
-type WebServer struct {
-	Router        chi.Router
-	Handlers      map[string]http.HandlerFunc
-	WebServerPort string
-}
-
-func NewWebServer(serverPort string) *WebServer {
-	return &WebServer{
-		Router:        chi.NewRouter(),
-		Handlers:      make(map[string]http.HandlerFunc),
-		WebServerPort: serverPort,
-	}
-}
-
-func (s *WebServer) AddHandler(path string, handler http.HandlerFunc) {
-	s.Handlers[path] = handler
-}
-
-// loop through the handlers and add them to the router
-// register middeleware logger
-// start the server
-func (s *WebServer) Start() {
-	//for path, handler := range s.Handlers {
-	//	s.Router.Handle(path, handler)
-	//}
-	fmt.Println("Starting web server on port", s.WebServerPort)
-	http.ListenAndServe(s.WebServerPort, s.Router)
-}
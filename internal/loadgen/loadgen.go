@@ -0,0 +1,233 @@
+// Package loadgen drives servico-a with a configurable load and summarises
+// the latencies, errors and traces of the requests it sends.
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Mode selects what the profile targets mean
+type Mode string
+
+const (
+	// RPS sends requests at the target rate regardless of response times
+	RPS Mode = "rps"
+	// Concurrency keeps the target number of requests in flight
+	Concurrency Mode = "concurrency"
+)
+
+// poll is how often an idle scheduler or worker checks the profile again
+const poll = 10 * time.Millisecond
+
+// Config describes a load generation run
+type Config struct {
+	// Target is the servico-a endpoint receiving {"cep": ...} POST requests
+	Target  string
+	CEPs    []string
+	Mode    Mode
+	Profile Profile
+	Timeout time.Duration
+	// SlowSize is the number of slowest requests listed in the report
+	SlowSize int
+	// Header is sent with every request, e.g. an API key
+	Header http.Header
+	Client *http.Client
+}
+
+// Run sends requests following cfg until the profile ends or ctx is done,
+// then waits for the in-flight requests and returns the report
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if len(cfg.CEPs) == 0 {
+		return nil, errors.New("at least one CEP is required")
+	}
+	if cfg.Profile.Duration() <= 0 {
+		return nil, errors.New("the load profile has no duration")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: cfg.Timeout}
+	}
+
+	g := &generator{cfg: cfg, report: &Report{SlowSize: cfg.SlowSize}}
+	start := time.Now()
+	switch cfg.Mode {
+	case RPS:
+		g.runRate(ctx, start)
+	case Concurrency:
+		g.runWorkers(ctx, start)
+	default:
+		return nil, fmt.Errorf("unknown mode %q", cfg.Mode)
+	}
+	g.report.Elapsed = time.Since(start)
+	return g.report, nil
+}
+
+type generator struct {
+	cfg    Config
+	report *Report
+}
+
+// runRate is an open model: requests are scheduled at the target rate and do
+// not wait for the previous ones to complete. The rate is integrated over
+// time and checked again at least every poll, so a ramp starting near zero
+// speeds up as the target grows.
+func (g *generator) runRate(ctx context.Context, start time.Time) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// credit is the number of requests due; the first one goes right away
+	credit := 1.0
+	last := start
+	for {
+		now := time.Now()
+		rate, ok := g.cfg.Profile.TargetAt(now.Sub(start))
+		if !ok {
+			return
+		}
+		if rate <= 0 {
+			credit = 0
+		} else {
+			// do not burst more than a second of requests to catch up after
+			// a long stall
+			credit = min(credit+rate*now.Sub(last).Seconds(), max(rate, 1))
+		}
+		last = now
+
+		for ; credit >= 1; credit-- {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				g.send(ctx)
+			}()
+		}
+
+		wait := poll
+		if rate > 0 {
+			wait = min(wait, time.Duration((1-credit)/rate*float64(time.Second)))
+		}
+		if err := sleepUntil(ctx, now.Add(wait)); err != nil {
+			return
+		}
+	}
+}
+
+// runWorkers is a closed model: worker i sends requests back to back while
+// the target concurrency is above i
+func (g *generator) runWorkers(ctx context.Context, start time.Time) {
+	var wg sync.WaitGroup
+	workers := int(math.Ceil(g.cfg.Profile.Max()))
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				target, ok := g.cfg.Profile.TargetAt(time.Since(start))
+				if !ok {
+					return
+				}
+				if float64(i) >= target {
+					if sleepUntil(ctx, time.Now().Add(poll)) != nil {
+						return
+					}
+					continue
+				}
+				g.send(ctx)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// send posts a random CEP with a fresh traceparent, so the trace ID of every
+// request is known even when the target samples it
+func (g *generator) send(ctx context.Context) {
+	traceID, spanID := newIDs()
+	res := Result{TraceID: traceID.String()}
+
+	body, _ := json.Marshal(map[string]string{"cep": g.cfg.CEPs[rand.IntN(len(g.cfg.CEPs))]})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.Target, bytes.NewReader(body))
+	if err != nil {
+		res.Error = "invalid request"
+		g.report.add(res)
+		return
+	}
+	for name, values := range g.cfg.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", traceID, spanID))
+
+	started := time.Now()
+	resp, err := g.cfg.Client.Do(req)
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	res.Latency = time.Since(started)
+
+	switch {
+	case err != nil:
+		res.Error = classify(ctx, err)
+	case resp.StatusCode >= http.StatusBadRequest:
+		res.Status = resp.StatusCode
+		res.Error = fmt.Sprintf("HTTP %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	default:
+		res.Status = resp.StatusCode
+	}
+	g.report.add(res)
+}
+
+func classify(ctx context.Context, err error) string {
+	var netErr net.Error
+	switch {
+	case ctx.Err() != nil:
+		return "cancelled"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection reset"
+	}
+	return "network error"
+}
+
+func newIDs() (trace.TraceID, trace.SpanID) {
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	for i := range traceID {
+		traceID[i] = byte(rand.UintN(256))
+	}
+	for i := range spanID {
+		spanID[i] = byte(rand.UintN(256))
+	}
+	return traceID, spanID
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,238 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRamp(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []Stage
+		wantErr bool
+	}{
+		{
+			name: "should parse a single stage",
+			spec: "30s@10",
+			want: []Stage{{Duration: 30 * time.Second, Target: 10}},
+		},
+		{
+			name: "should parse several stages",
+			spec: "30s@10, 1m@50,10s@0",
+			want: []Stage{
+				{Duration: 30 * time.Second, Target: 10},
+				{Duration: time.Minute, Target: 50},
+				{Duration: 10 * time.Second, Target: 0},
+			},
+		},
+		{name: "should reject a stage without target", spec: "30s", wantErr: true},
+		{name: "should reject an invalid duration", spec: "soon@10", wantErr: true},
+		{name: "should reject a negative target", spec: "10s@-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRamp(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRamp(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Start != 0 || len(got.Stages) != len(tt.want) {
+				t.Fatalf("ParseRamp(%q) = %+v, want stages %+v", tt.spec, got, tt.want)
+			}
+			for i := range tt.want {
+				if got.Stages[i] != tt.want[i] {
+					t.Errorf("stage %d = %+v, want %+v", i, got.Stages[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestProfile_TargetAt(t *testing.T) {
+	ramp, _ := ParseRamp("10s@10,10s@10,10s@0")
+
+	tests := []struct {
+		name    string
+		profile Profile
+		elapsed time.Duration
+		want    float64
+		wantOK  bool
+	}{
+		{name: "should start a ramp at zero", profile: ramp, elapsed: 0, want: 0, wantOK: true},
+		{name: "should interpolate while ramping up", profile: ramp, elapsed: 5 * time.Second, want: 5, wantOK: true},
+		{name: "should hold a flat stage", profile: ramp, elapsed: 15 * time.Second, want: 10, wantOK: true},
+		{name: "should interpolate while ramping down", profile: ramp, elapsed: 25 * time.Second, want: 5, wantOK: true},
+		{name: "should end after the last stage", profile: ramp, elapsed: 30 * time.Second, want: 0, wantOK: false},
+		{name: "should hold a constant profile", profile: Constant(20, time.Second), elapsed: 0, want: 20, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.profile.TargetAt(tt.elapsed)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("TargetAt(%s) = %v, %v, want %v, %v", tt.elapsed, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{p: 0.50, want: 50 * time.Millisecond},
+		{p: 0.99, want: 99 * time.Millisecond},
+		{p: 1, want: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := Percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("Percentile(%v) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+	if got := Percentile(nil, 0.5); got != 0 {
+		t.Errorf("Percentile(nil) = %s, want 0", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	traceparent := regexp.MustCompile(`^00-([0-9a-f]{32})-[0-9a-f]{16}-01$`)
+
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		match := traceparent.FindStringSubmatch(r.Header.Get("traceparent"))
+		if match == nil {
+			t.Errorf("unexpected traceparent %q", r.Header.Get("traceparent"))
+		} else {
+			mu.Lock()
+			seen[match[1]] = true
+			mu.Unlock()
+		}
+
+		var body struct {
+			CEP string `json:"cep"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.CEP == "00000000" {
+			http.Error(w, "invalid zipcode", http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		mode Mode
+	}{
+		{name: "should send requests at a target rate", mode: RPS},
+		{name: "should keep the target concurrency", mode: Concurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Run(context.Background(), Config{
+				Target:   server.URL,
+				CEPs:     []string{"01001000", "00000000"},
+				Mode:     tt.mode,
+				Profile:  Constant(50, 200*time.Millisecond),
+				Timeout:  time.Second,
+				SlowSize: 3,
+			})
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			results := report.Results()
+			if len(results) == 0 {
+				t.Fatal("expected requests to be sent")
+			}
+			errs := report.Errors()
+			for class := range errs {
+				if class != "HTTP 422 Unprocessable Entity" {
+					t.Errorf("unexpected error class %q", class)
+				}
+			}
+			if len(report.Slowest(3)) != min(3, len(results)) {
+				t.Errorf("expected the 3 slowest requests")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, res := range results {
+				if !seen[res.TraceID] {
+					t.Errorf("trace ID %s was not sent to the target", res.TraceID)
+				}
+			}
+		})
+	}
+}
+
+func TestRun_RampInRPSMode(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	// from zero to 100 rps in one second: about 50 requests
+	ramp, err := ParseRamp("1s@100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report, err := Run(ctx, Config{
+		Target:  server.URL,
+		CEPs:    []string{"01001000"},
+		Mode:    RPS,
+		Profile: ramp,
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Elapsed > 2*time.Second {
+		t.Errorf("Run() took %s, want it to end with the 1s ramp", report.Elapsed)
+	}
+	if got := calls.Load(); got < 35 || got > 65 {
+		t.Errorf("requests = %d, want about 50", got)
+	}
+}
+
+func TestRun_ConnectionRefused(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	target := server.URL
+	server.Close()
+
+	report, err := Run(context.Background(), Config{
+		Target:  target,
+		CEPs:    []string{"01001000"},
+		Mode:    Concurrency,
+		Profile: Constant(1, 50*time.Millisecond),
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Errors()["connection refused"] == 0 {
+		t.Errorf("Errors() = %v, want connection refused", report.Errors())
+	}
+}
@@ -0,0 +1,81 @@
+package loadgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stage ramps the load linearly to Target over Duration
+type Stage struct {
+	Duration time.Duration
+	Target   float64
+}
+
+// Profile describes the load over time: it starts at Start and goes through
+// each stage in order. Targets are requests per second or concurrent
+// workers, depending on the mode of the run.
+type Profile struct {
+	Start  float64
+	Stages []Stage
+}
+
+// Constant returns a profile holding target for d
+func Constant(target float64, d time.Duration) Profile {
+	return Profile{Start: target, Stages: []Stage{{Duration: d, Target: target}}}
+}
+
+// ParseRamp parses a ramp-up profile such as "30s@10,1m@50,30s@0", starting
+// from zero: each stage ramps linearly to its target over its duration.
+func ParseRamp(s string) (Profile, error) {
+	var p Profile
+	for _, part := range strings.Split(s, ",") {
+		durationStr, targetStr, ok := strings.Cut(strings.TrimSpace(part), "@")
+		if !ok {
+			return p, fmt.Errorf("invalid stage %q: expected <duration>@<target>", part)
+		}
+		d, err := time.ParseDuration(durationStr)
+		if err != nil || d <= 0 {
+			return p, fmt.Errorf("invalid stage duration %q", durationStr)
+		}
+		target, err := strconv.ParseFloat(targetStr, 64)
+		if err != nil || target < 0 {
+			return p, fmt.Errorf("invalid stage target %q", targetStr)
+		}
+		p.Stages = append(p.Stages, Stage{Duration: d, Target: target})
+	}
+	return p, nil
+}
+
+// Duration returns the total duration of the profile
+func (p Profile) Duration() time.Duration {
+	var total time.Duration
+	for _, s := range p.Stages {
+		total += s.Duration
+	}
+	return total
+}
+
+// Max returns the highest target reached by the profile
+func (p Profile) Max() float64 {
+	highest := p.Start
+	for _, s := range p.Stages {
+		highest = max(highest, s.Target)
+	}
+	return highest
+}
+
+// TargetAt returns the target after elapsed, and false once the profile is over
+func (p Profile) TargetAt(elapsed time.Duration) (float64, bool) {
+	from := p.Start
+	for _, s := range p.Stages {
+		if elapsed < s.Duration {
+			progress := float64(elapsed) / float64(s.Duration)
+			return from + (s.Target-from)*progress, true
+		}
+		elapsed -= s.Duration
+		from = s.Target
+	}
+	return from, false
+}
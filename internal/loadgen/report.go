@@ -0,0 +1,133 @@
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Result is the outcome of a single request
+type Result struct {
+	Latency time.Duration
+	Status  int
+	// Error classifies failed requests, e.g. "HTTP 404" or "timeout"
+	Error   string
+	TraceID string
+}
+
+// Report aggregates the results of a run
+type Report struct {
+	mu       sync.Mutex
+	results  []Result
+	Elapsed  time.Duration
+	SlowSize int
+}
+
+func (r *Report) add(res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, res)
+}
+
+// Results returns a copy of the collected results
+func (r *Report) Results() []Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.results)
+}
+
+// Percentile returns the p-th percentile (0 < p <= 1) of the latencies
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(idx, 0), len(sorted)-1)]
+}
+
+// Errors returns the number of failed requests per error class
+func (r *Report) Errors() map[string]int {
+	errs := make(map[string]int)
+	for _, res := range r.Results() {
+		if res.Error != "" {
+			errs[res.Error]++
+		}
+	}
+	return errs
+}
+
+// Slowest returns the n slowest requests, slowest first
+func (r *Report) Slowest(n int) []Result {
+	results := r.Results()
+	sort.Slice(results, func(i, j int) bool { return results[i].Latency > results[j].Latency })
+	return results[:min(n, len(results))]
+}
+
+// Print writes the summary of the run
+func (r *Report) Print(w io.Writer) {
+	results := r.Results()
+	latencies := make([]time.Duration, 0, len(results))
+	for _, res := range results {
+		latencies = append(latencies, res.Latency)
+	}
+	slices.Sort(latencies)
+
+	errs := r.Errors()
+	failed := 0
+	for _, count := range errs {
+		failed += count
+	}
+
+	fmt.Fprintf(w, "requests: %d  succeeded: %d  failed: %d  elapsed: %s", len(results), len(results)-failed, failed, r.Elapsed.Round(time.Millisecond))
+	if r.Elapsed > 0 {
+		fmt.Fprintf(w, "  throughput: %.1f req/s", float64(len(results))/r.Elapsed.Seconds())
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "\nlatency:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  p50\tp90\tp95\tp99\tmax")
+	fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n",
+		round(Percentile(latencies, 0.50)),
+		round(Percentile(latencies, 0.90)),
+		round(Percentile(latencies, 0.95)),
+		round(Percentile(latencies, 0.99)),
+		round(Percentile(latencies, 1)))
+	tw.Flush()
+
+	if len(errs) > 0 {
+		fmt.Fprintln(w, "\nerrors:")
+		classes := make([]string, 0, len(errs))
+		for class := range errs {
+			classes = append(classes, class)
+		}
+		sort.Slice(classes, func(i, j int) bool { return errs[classes[i]] > errs[classes[j]] })
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, class := range classes {
+			fmt.Fprintf(tw, "  %s\t%d\n", class, errs[class])
+		}
+		tw.Flush()
+	}
+
+	if slow := r.Slowest(r.SlowSize); len(slow) > 0 {
+		fmt.Fprintln(w, "\nslowest requests:")
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  TRACE ID\tLATENCY\tSTATUS")
+		for _, res := range slow {
+			status := fmt.Sprint(res.Status)
+			if res.Error != "" && res.Status == 0 {
+				status = res.Error
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", res.TraceID, round(res.Latency), status)
+		}
+		tw.Flush()
+	}
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(100 * time.Microsecond)
+}
@@ -1,6 +1,12 @@
 package usecase
 
+import (
+	"context"
+
+	"github.com/samucadutra/lab-otel-goexpert/internal/usecase/servico_b_usecase"
+)
+
 // ServicoBWeatherUseCaseInterface defines the interface for getting weather by zipcode
 type ServicoBWeatherUseCaseInterface interface {
-	Execute(zipcode string) (map[string]float64, error)
+	Execute(ctx context.Context, zipcode string) (*servico_b_usecase.WeatherOutput, error)
 }
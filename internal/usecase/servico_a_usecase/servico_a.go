@@ -3,28 +3,118 @@ package servico_a_usecase
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/spf13/viper"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+	"github.com/samucadutra/lab-otel-goexpert/internal/cep"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/auth"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/httpclient"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/tlsconfig"
+	"go.opentelemetry.io/otel/trace"
+	"io"
 	"log"
 	"net/http"
-	"regexp"
+	"strings"
 )
 
+// ErrWeatherUnavailable is returned when servico-b cannot fetch the weather
+// for now, e.g. because the WeatherAPI quota is exhausted
+var ErrWeatherUnavailable = errors.New("weather data unavailable")
+
+// UnavailableError carries why servico-b cannot fetch the weather and when
+// to try again, so servico-a can pass both on. It matches
+// ErrWeatherUnavailable.
+type UnavailableError struct {
+	Reason string
+	// RetryAfter is the Retry-After header of servico-b, if any
+	RetryAfter string
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrWeatherUnavailable, e.Reason)
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return ErrWeatherUnavailable
+}
+
+// ErrServicoBNotConfigured is returned by servico-a when the process was
+// started without EXTERNAL_CALL_URL
+var ErrServicoBNotConfigured = errors.New("no servico-b client: EXTERNAL_CALL_URL is not set")
+
+// NewServicoBClient builds the resilient client used to call servico-b from
+// cfg, failing fast on an invalid URL. Its background workers run between
+// Start and Close.
+func NewServicoBClient(cfg configs.ServicoB) (*httpclient.Client, error) {
+	resolver, err := httpclient.ParseEndpoints(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EXTERNAL_CALL_URL: %w", err)
+	}
+	tlsConfig, err := tlsconfig.Client(tlsconfig.ClientOptions{
+		CAFiles:        cfg.CAFile,
+		CertFile:       cfg.ClientCertFile,
+		KeyFile:        cfg.ClientKeyFile,
+		ServerName:     cfg.ServerName,
+		ReloadInterval: cfg.TLSReloadInterval,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid servico-b TLS settings: %w", err)
+	}
+	header := make(http.Header)
+	if cfg.APIKey != "" {
+		header.Set(auth.DefaultAPIKeyHeader, cfg.APIKey)
+	}
+	return httpclient.New(httpclient.Config{
+		Name:                "servico-b",
+		AttemptTimeout:      cfg.AttemptTimeout,
+		MaxAttempts:         cfg.MaxAttempts,
+		BackoffBase:         cfg.BackoffBase,
+		BackoffMax:          cfg.BackoffMax,
+		BreakerThreshold:    cfg.BreakerThreshold,
+		BreakerCooldown:     cfg.BreakerCooldown,
+		Policy:              httpclient.Policy(cfg.LBPolicy),
+		ResolveInterval:     cfg.ResolveInterval,
+		HealthCheckPath:     cfg.HealthCheckPath,
+		HealthCheckInterval: cfg.HealthCheckInterval,
+		HealthCheckTimeout:  cfg.HealthCheckTimeout,
+		HedgePercentile:     cfg.HedgePercentile,
+		HedgeMinDelay:       cfg.HedgeMinDelay,
+		HedgeMaxDelay:       cfg.HedgeMaxDelay,
+		TLS:                 tlsConfig,
+		Header:              header,
+	}, resolver), nil
+}
+
+// PingServicoB checks that at least one servico-b instance answers on its
+// health check path, /healthz when SERVICO_B_HEALTH_CHECK_PATH is empty
+func PingServicoB(ctx context.Context, client *httpclient.Client, path string) error {
+	if client == nil {
+		return ErrServicoBNotConfigured
+	}
+	if path == "" {
+		path = "/healthz"
+	}
+	return client.Balancer().Ping(ctx, path)
+}
+
 type ServicoAUseCase struct {
 	ZipCode interface{}
+	// ServicoB is the client servico-b is called with
+	ServicoB *httpclient.Client
 }
 
 type WeatherData struct {
+	City  string  `json:"city,omitempty"`
+	UF    string  `json:"uf,omitempty"`
 	TempC float64 `json:"temp_c"`
 	TempF float64 `json:"temp_f"`
 	TempK float64 `json:"temp_k"`
 }
 
-func NewServicoAUseCase(zipcode interface{}) *ServicoAUseCase {
+func NewServicoAUseCase(zipcode interface{}, servicoB *httpclient.Client) *ServicoAUseCase {
 	return &ServicoAUseCase{
-		ZipCode: zipcode,
+		ZipCode:  zipcode,
+		ServicoB: servicoB,
 	}
 }
 
@@ -40,25 +130,29 @@ func (uc *ServicoAUseCase) Execute(ctx context.Context) (*WeatherData, bool, err
 		return nil, false, fmt.Errorf("invalid zipcode")
 	}
 
-	weatherData, err := fetchCurrentWeather(ctx, zipCodeStr)
+	uf, ok := cep.LookupUF(zipCodeStr)
+	if !ok {
+		log.Println("ZipCode is in an unallocated range")
+		return nil, false, fmt.Errorf("invalid zipcode")
+	}
+	trace.SpanFromContext(ctx).SetAttributes(cep.UFKey.String(uf))
+
+	weatherData, err := fetchCurrentWeather(ctx, uc.ServicoB, zipCodeStr)
 	if err != nil {
-		return nil, true, fmt.Errorf("%s", err.Error())
+		return nil, true, fmt.Errorf("%w", err)
+	}
+	if weatherData.UF == "" {
+		weatherData.UF = uf
 	}
 
 	return weatherData, true, nil
 }
 
-func fetchCurrentWeather(ctx context.Context, zipcode string) (*WeatherData, error) {
-	externalCallURL := viper.GetString("EXTERNAL_CALL_URL")
-	var req *http.Request
-	var err error
-	req, err = http.NewRequestWithContext(ctx, "GET", externalCallURL+"/"+zipcode, nil)
-	//resp, err := http.Get(externalCallURL + "/" + zipcode)
-	if err != nil {
-		return nil, fmt.Errorf(err.Error(), err)
+func fetchCurrentWeather(ctx context.Context, client *httpclient.Client, zipcode string) (*WeatherData, error) {
+	if client == nil {
+		return nil, fmt.Errorf("failed to fetch weather data: %w", ErrServicoBNotConfigured)
 	}
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Get(ctx, "/"+zipcode)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch weather data: %w", err)
 	}
@@ -67,6 +161,16 @@ func fetchCurrentWeather(ctx context.Context, zipcode string) (*WeatherData, err
 		if resp.StatusCode == http.StatusNotFound {
 			return nil, fmt.Errorf("can not find zipcode")
 		}
+		if resp.StatusCode == http.StatusGatewayTimeout {
+			return nil, fmt.Errorf("failed to fetch weather data: %w", context.DeadlineExceeded)
+		}
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			reason, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return nil, &UnavailableError{
+				Reason:     strings.TrimSpace(string(reason)),
+				RetryAfter: resp.Header.Get("Retry-After"),
+			}
+		}
 		return nil, fmt.Errorf("failed to fetch weather data: %s", resp.Status)
 	}
 
@@ -78,6 +182,5 @@ func fetchCurrentWeather(ctx context.Context, zipcode string) (*WeatherData, err
 	return &weatherData, nil
 }
 func isValidZipCode(zipcode string) bool {
-	re := regexp.MustCompile(`^\d{8}$`)
-	return re.MatchString(zipcode)
+	return cep.IsValidFormat(zipcode)
 }
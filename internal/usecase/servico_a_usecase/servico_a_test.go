@@ -2,12 +2,14 @@ package servico_a_usecase
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"testing"
 
-	"github.com/spf13/viper"
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/httpclient"
 )
 
 func TestNewServicoAUseCase(t *testing.T) {
@@ -35,7 +37,7 @@ func TestNewServicoAUseCase(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := NewServicoAUseCase(tt.zipCode)
+			got := NewServicoAUseCase(tt.zipCode, nil)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewServicoAUseCase() = %v, want %v", got, tt.want)
 			}
@@ -104,8 +106,7 @@ func TestServicoAUseCase_Execute(t *testing.T) {
 	}))
 	defer server.Close()
 
-	// Set up viper config to use mock server
-	viper.Set("EXTERNAL_CALL_URL", server.URL)
+	client := newServicoBClient(t, server.URL)
 
 	tests := []struct {
 		name        string
@@ -119,6 +120,7 @@ func TestServicoAUseCase_Execute(t *testing.T) {
 			name:    "should succeed with valid zipcode",
 			zipCode: "12345678",
 			wantData: &WeatherData{
+				UF:    "SP",
 				TempC: 25.5,
 				TempF: 77.9,
 				TempK: 298.65,
@@ -134,6 +136,14 @@ func TestServicoAUseCase_Execute(t *testing.T) {
 			wantErrMsg:  "invalid zipcode",
 			expectError: true,
 		},
+		{
+			name:        "should fail with unallocated zipcode range",
+			zipCode:     "00000000",
+			wantData:    nil,
+			wantOk:      false,
+			wantErrMsg:  "invalid zipcode",
+			expectError: true,
+		},
 		{
 			name:        "should fail with non-string zipcode",
 			zipCode:     12345678,
@@ -170,7 +180,7 @@ func TestServicoAUseCase_Execute(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			uc := NewServicoAUseCase(tt.zipCode)
+			uc := NewServicoAUseCase(tt.zipCode, client)
 			gotData, gotOk, err := uc.Execute(ctx)
 
 			// Verify the ok result
@@ -217,6 +227,9 @@ func TestFetchCurrentWeather(t *testing.T) {
 			w.WriteHeader(http.StatusNotFound)
 		case "/88888888":
 			w.WriteHeader(http.StatusInternalServerError)
+		case "/77777777":
+			w.Header().Set("Retry-After", "259200")
+			http.Error(w, "weatherapi quota exhausted: monthly budget used, resets in 72h0m0s", http.StatusServiceUnavailable)
 		case "/malformed":
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte(`{malformed json}`))
@@ -224,8 +237,7 @@ func TestFetchCurrentWeather(t *testing.T) {
 	}))
 	defer server.Close()
 
-	// Set up viper config to use mock server
-	viper.Set("EXTERNAL_CALL_URL", server.URL)
+	client := newServicoBClient(t, server.URL)
 
 	tests := []struct {
 		name        string
@@ -258,6 +270,13 @@ func TestFetchCurrentWeather(t *testing.T) {
 			expectError: true,
 			errorMsg:    "failed to fetch weather data",
 		},
+		{
+			name:        "should pass on the reason servico-b is unavailable",
+			zipCode:     "77777777",
+			wantData:    nil,
+			expectError: true,
+			errorMsg:    "weather data unavailable: weatherapi quota exhausted: monthly budget used",
+		},
 		{
 			name:        "should return error for malformed JSON",
 			zipCode:     "malformed",
@@ -269,7 +288,13 @@ func TestFetchCurrentWeather(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotData, err := fetchCurrentWeather(ctx, tt.zipCode)
+			gotData, err := fetchCurrentWeather(ctx, client, tt.zipCode)
+			if errors.Is(err, ErrWeatherUnavailable) {
+				var unavailable *UnavailableError
+				if !errors.As(err, &unavailable) || unavailable.RetryAfter != "259200" {
+					t.Errorf("fetchCurrentWeather() error = %#v, want Retry-After 259200", err)
+				}
+			}
 
 			if (err != nil) != tt.expectError {
 				t.Errorf("fetchCurrentWeather() error = %v, expectError %v", err, tt.expectError)
@@ -287,3 +312,19 @@ func TestFetchCurrentWeather(t *testing.T) {
 		})
 	}
 }
+
+// newServicoBClient starts a servico-b client pointing to url for the test
+func newServicoBClient(t *testing.T, url string) *httpclient.Client {
+	t.Helper()
+	cfg := configs.Default().ServicoB
+	cfg.URL = url
+	client, err := NewServicoBClient(cfg)
+	if err != nil {
+		t.Fatalf("NewServicoBClient() error = %v", err)
+	}
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
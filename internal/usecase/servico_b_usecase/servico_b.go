@@ -1,69 +1,160 @@
 package servico_b_usecase
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"regexp"
+
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+	"github.com/samucadutra/lab-otel-goexpert/internal/cep"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/keypool"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/quota"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/redact"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
-	httpGet        = http.Get
-	httpNewRequest = http.NewRequest
+	httpNewRequest = http.NewRequestWithContext
 	httpClientDo   = http.DefaultClient.Do
 
 	isValidZipCodeFn = isValidZipCodeImpl
+	lookupUFFn       = cep.LookupUF
 	fetchLocationFn  = fetchLocationImpl
 	fetchWeatherFn   = fetchWeatherImpl
 )
 
+// ErrInvalidZipCode is returned for a zipcode that is malformed or in an
+// unallocated CEP range
+var ErrInvalidZipCode = errors.New("invalid zipcode")
+
+// weatherAPIQuotaExceeded is the WeatherAPI error code for an account over
+// its monthly calls
+const weatherAPIQuotaExceeded = 2007
+
+const (
+	viaCEPURL     = "https://viacep.com.br/ws/%s/json/"
+	weatherAPIURL = "http://api.weatherapi.com/v1/current.json"
+)
+
 type WeatherData struct {
 	TempC float64 `json:"temp_c"`
 	TempF float64 `json:"temp_f"`
 }
 
+// WeatherOutput is the servico-b response for a zipcode
+type WeatherOutput struct {
+	City  string  `json:"city"`
+	UF    string  `json:"uf"`
+	TempC float64 `json:"temp_C"`
+	TempF float64 `json:"temp_F"`
+	TempK float64 `json:"temp_K"`
+}
+
 type ServicoBUseCase struct {
-	WeatherApiKey string
+	WeatherAPIKeys *keypool.Pool
+	// WeatherAPIQuota guards the WeatherAPI calls; nil applies no limit
+	WeatherAPIQuota *quota.Limiter
+}
+
+func NewServicoBUseCase(keys *keypool.Pool, weatherAPIQuota *quota.Limiter) *ServicoBUseCase {
+	return &ServicoBUseCase{WeatherAPIKeys: keys, WeatherAPIQuota: weatherAPIQuota}
 }
 
-func NewServicoBUseCase(apiKey string) *ServicoBUseCase {
-	return &ServicoBUseCase{WeatherApiKey: apiKey}
+// keyRejectedError is returned when WeatherAPI refuses the key itself, so the
+// request can be retried with another key of the pool
+type keyRejectedError struct {
+	reason string
 }
 
-func (uc *ServicoBUseCase) Execute(zipcode string) (map[string]float64, error) {
+func (e *keyRejectedError) Error() string {
+	return fmt.Sprintf("failed to fetch weather data: API key rejected (%s)", e.reason)
+}
+
+func (uc *ServicoBUseCase) Execute(ctx context.Context, zipcode string) (*WeatherOutput, error) {
 	if !isValidZipCodeFn(zipcode) {
-		return nil, fmt.Errorf("invalid zipcode")
+		return nil, ErrInvalidZipCode
 	}
 
-	location, err := fetchLocationFn(zipcode)
+	// reject unallocated CEP ranges before spending a ViaCEP round-trip
+	uf, ok := lookupUFFn(zipcode)
+	if !ok {
+		return nil, ErrInvalidZipCode
+	}
+	trace.SpanFromContext(ctx).SetAttributes(cep.UFKey.String(uf))
+
+	location, err := fetchLocationFn(ctx, zipcode)
 	if err != nil {
-		return nil, fmt.Errorf("%s", err.Error())
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	// the caller may have given up while ViaCEP answered
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	weather, err := fetchWeatherFn(location, uc.WeatherApiKey)
+	weather, err := uc.fetchWeather(ctx, location)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch weather data: %w", err)
 	}
 
 	tempK := weather.TempC + 273.15
 
-	return map[string]float64{
-		"temp_C": weather.TempC,
-		"temp_F": weather.TempF,
-		"temp_K": tempK,
+	return &WeatherOutput{
+		City:  location,
+		UF:    uf,
+		TempC: weather.TempC,
+		TempF: weather.TempF,
+		TempK: tempK,
 	}, nil
 }
 
+// fetchWeather calls WeatherAPI with the current key of the pool, moving on
+// to the next key when WeatherAPI rejects it
+func (uc *ServicoBUseCase) fetchWeather(ctx context.Context, location string) (*WeatherData, error) {
+	for {
+		key, err := uc.WeatherAPIKeys.Get()
+		var unavailable *keypool.UnavailableError
+		if errors.As(err, &unavailable) {
+			// every key is over its monthly quota: so is the account budget
+			if unavailable.Quota {
+				if err := uc.WeatherAPIQuota.Exhaust(); err != nil {
+					return nil, err
+				}
+			}
+			return nil, &quota.ExhaustedError{Name: "weatherapi", Reason: quota.ReasonKeys, RetryAfter: unavailable.RetryAfter}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		uc.WeatherAPIKeys.Record(key)
+		weather, err := fetchWeatherFn(ctx, uc.WeatherAPIQuota, location, key.Value)
+		var rejected *keyRejectedError
+		if !errors.As(err, &rejected) {
+			return weather, err
+		}
+		log.Printf("WeatherAPI rejected key %s (%s), rotating", key.Fingerprint, rejected.reason)
+		uc.WeatherAPIKeys.Reject(key, rejected.reason)
+	}
+}
+
 func isValidZipCodeImpl(zipcode string) bool {
-	re := regexp.MustCompile(`^\d{8}$`)
-	return re.MatchString(zipcode)
+	return cep.IsValidFormat(zipcode)
 }
 
-func fetchLocationImpl(zipcode string) (string, error) {
-	resp, err := httpGet(fmt.Sprintf("https://viacep.com.br/ws/%s/json/", zipcode))
+func fetchLocationImpl(ctx context.Context, zipcode string) (string, error) {
+	req, err := httpNewRequest(ctx, "GET", fmt.Sprintf(viaCEPURL, zipcode), nil)
 	if err != nil {
 		return "", err
 	}
+
+	resp, err := httpClientDo(req)
+	if err != nil {
+		return "", redact.Error(err)
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
@@ -84,9 +175,28 @@ func fetchLocationImpl(zipcode string) (string, error) {
 	return data.Localidade, nil
 }
 
-func fetchWeatherImpl(location, apiKey string) (*WeatherData, error) {
-	baseURL := "http://api.weatherapi.com/v1/current.json"
-	req, err := httpNewRequest("GET", baseURL, nil)
+// NewWeatherAPIQuota builds the limiter guarding the WeatherAPI calls from
+// the limits of cfg. Close saves the usage to its state file.
+func NewWeatherAPIQuota(cfg configs.WeatherAPI) (*quota.Limiter, error) {
+	limiter, err := quota.New(quota.Config{
+		Name:          "weatherapi",
+		RPS:           cfg.RPS,
+		Burst:         cfg.Burst,
+		MonthlyBudget: cfg.MonthlyBudget,
+		StateFile:     cfg.QuotaFile,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid WeatherAPI quota settings: %w", err)
+	}
+	return limiter, nil
+}
+
+func fetchWeatherImpl(ctx context.Context, limiter *quota.Limiter, location, apiKey string) (*WeatherData, error) {
+	if err := limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := httpNewRequest(ctx, "GET", weatherAPIURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -98,11 +208,29 @@ func fetchWeatherImpl(location, apiKey string) (*WeatherData, error) {
 
 	resp, err := httpClientDo(req)
 	if err != nil {
-		return nil, err
+		// the error carries the URL, and with it the key
+		return nil, redact.Error(err)
 	}
 	defer resp.Body.Close()
 
+	if err := limiter.Observe(resp); err != nil {
+		return nil, err
+	}
 	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error struct {
+				Code int `json:"code"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		switch {
+		case failure.Error.Code == weatherAPIQuotaExceeded:
+			return nil, &keyRejectedError{reason: keypool.ReasonQuota}
+		case resp.StatusCode == http.StatusUnauthorized:
+			return nil, &keyRejectedError{reason: keypool.ReasonUnauthorized}
+		case resp.StatusCode == http.StatusForbidden:
+			return nil, &keyRejectedError{reason: keypool.ReasonForbidden}
+		}
 		return nil, fmt.Errorf("failed to fetch weather data")
 	}
 
@@ -115,3 +243,31 @@ func fetchWeatherImpl(location, apiKey string) (*WeatherData, error) {
 
 	return &data.Current, nil
 }
+
+// PingViaCEP checks that ViaCEP answers a lookup for a well-known CEP
+func PingViaCEP(ctx context.Context) error {
+	return ping(ctx, fmt.Sprintf(viaCEPURL, "01001000"))
+}
+
+// PingWeatherAPI checks that WeatherAPI answers. The request carries no key,
+// so the API rejects it, which still proves it is reachable.
+func PingWeatherAPI(ctx context.Context) error {
+	return ping(ctx, weatherAPIURL)
+}
+
+// ping succeeds when url answers with a status below 500
+func ping(ctx context.Context, url string) error {
+	req, err := httpNewRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClientDo(req)
+	if err != nil {
+		return redact.Error(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
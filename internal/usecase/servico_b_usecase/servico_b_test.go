@@ -1,37 +1,49 @@
 package servico_b_usecase
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/samucadutra/lab-otel-goexpert/configs"
+	"github.com/samucadutra/lab-otel-goexpert/internal/cep"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/keypool"
+	"github.com/samucadutra/lab-otel-goexpert/internal/infra/quota"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestNewServicoBUseCase(t *testing.T) {
 	tests := []struct {
-		name   string
-		apiKey string
-		want   *ServicoBUseCase
+		name     string
+		keys     *keypool.Pool
+		wantKeys int
 	}{
 		{
-			name:   "should create a new service with API key",
-			apiKey: "test-api-key",
-			want:   &ServicoBUseCase{WeatherApiKey: "test-api-key"},
+			name:     "should create a new service with a key pool",
+			keys:     keypool.New("weatherapi", []string{"test-api-key", "other-key"}, 0),
+			wantKeys: 2,
 		},
 		{
-			name:   "should create a new service with empty API key",
-			apiKey: "",
-			want:   &ServicoBUseCase{WeatherApiKey: ""},
+			name:     "should create a new service without keys",
+			keys:     nil,
+			wantKeys: 0,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := NewServicoBUseCase(tt.apiKey)
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("NewServicoBUseCase() = %v, want %v", got, tt.want)
+			got := NewServicoBUseCase(tt.keys, nil)
+			if got.WeatherAPIKeys != tt.keys || got.WeatherAPIKeys.Len() != tt.wantKeys {
+				t.Errorf("NewServicoBUseCase() keys = %v, want %d keys", got.WeatherAPIKeys, tt.wantKeys)
 			}
 		})
 	}
@@ -104,12 +116,12 @@ func TestFetchLocation(t *testing.T) {
 	defer locationServer.Close()
 
 	// Override the viacep URL for testing
-	originalGet := httpGet
-	httpGet = func(url string) (*http.Response, error) {
+	originalNewRequest := httpNewRequest
+	httpNewRequest = func(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
 		newURL := locationServer.URL + url[len("https://viacep.com.br"):]
-		return http.DefaultClient.Get(newURL)
+		return http.NewRequestWithContext(ctx, method, newURL, body)
 	}
-	defer func() { httpGet = originalGet }()
+	defer func() { httpNewRequest = originalNewRequest }()
 
 	tests := []struct {
 		name        string
@@ -149,7 +161,7 @@ func TestFetchLocation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := fetchLocationFn(tt.zipcode)
+			got, err := fetchLocationFn(context.Background(), tt.zipcode)
 
 			if (err != nil) != tt.expectError {
 				t.Errorf("fetchLocation() error = %v, expectError %v", err, tt.expectError)
@@ -201,9 +213,9 @@ func TestFetchWeather(t *testing.T) {
 	originalDo := httpClientDo
 
 	// Mock the functions for testing
-	httpNewRequest = func(method, url string, body io.Reader) (*http.Request, error) {
+	httpNewRequest = func(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
 		// Use the test server URL instead of the original URL
-		req, err := http.NewRequest(method, weatherServer.URL, body)
+		req, err := http.NewRequestWithContext(ctx, method, weatherServer.URL, body)
 		if err != nil {
 			return nil, err
 		}
@@ -267,7 +279,7 @@ func TestFetchWeather(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := fetchWeatherFn(tt.location, tt.apiKey)
+			got, err := fetchWeatherFn(context.Background(), nil, tt.location, tt.apiKey)
 
 			if (err != nil) != tt.expectError {
 				t.Errorf("fetchWeather() error = %v, expectError %v", err, tt.expectError)
@@ -288,6 +300,21 @@ func TestFetchWeather(t *testing.T) {
 	}
 }
 
+func TestFetchWeather_RedactsKey(t *testing.T) {
+	originalDo := httpClientDo
+	defer func() { httpClientDo = originalDo }()
+
+	// fails the way the real client does, with the full URL in the error
+	httpClientDo = func(req *http.Request) (*http.Response, error) {
+		return nil, &url.Error{Op: "Get", URL: req.URL.String(), Err: errors.New("connection refused")}
+	}
+
+	_, err := fetchWeatherImpl(context.Background(), nil, "São Paulo", "secret-key")
+	if err == nil || strings.Contains(err.Error(), "secret-key") {
+		t.Errorf("fetchWeatherImpl() error = %v, want the key masked", err)
+	}
+}
+
 func TestServicoBUseCase_Execute(t *testing.T) {
 	// Save original functions to restore later
 	originalIsValidZipCode := isValidZipCodeFn
@@ -310,7 +337,7 @@ func TestServicoBUseCase_Execute(t *testing.T) {
 		mockLocErr       error
 		mockWeather      *WeatherData
 		mockWeatherErr   error
-		want             map[string]float64
+		want             *WeatherOutput
 		expectError      bool
 		errorMsg         string
 	}{
@@ -323,10 +350,12 @@ func TestServicoBUseCase_Execute(t *testing.T) {
 			mockLocErr:       nil,
 			mockWeather:      &WeatherData{TempC: 25.5, TempF: 77.9},
 			mockWeatherErr:   nil,
-			want: map[string]float64{
-				"temp_C": 25.5,
-				"temp_F": 77.9,
-				"temp_K": 298.65,
+			want: &WeatherOutput{
+				City:  "São Paulo",
+				UF:    "SP",
+				TempC: 25.5,
+				TempF: 77.9,
+				TempK: 298.65,
 			},
 			expectError: false,
 		},
@@ -339,6 +368,16 @@ func TestServicoBUseCase_Execute(t *testing.T) {
 			expectError:      true,
 			errorMsg:         "invalid zipcode",
 		},
+		{
+			name:             "should return error for unallocated zipcode range",
+			zipcode:          "00000000",
+			apiKey:           "valid-key",
+			mockValidZipCode: true,
+			mockLocErr:       fmt.Errorf("location should not be fetched"),
+			want:             nil,
+			expectError:      true,
+			errorMsg:         "invalid zipcode",
+		},
 		{
 			name:             "should return error from location fetch",
 			zipcode:          "12345678",
@@ -372,16 +411,16 @@ func TestServicoBUseCase_Execute(t *testing.T) {
 				return tt.mockValidZipCode
 			}
 
-			fetchLocationFn = func(zipcode string) (string, error) {
+			fetchLocationFn = func(ctx context.Context, zipcode string) (string, error) {
 				return tt.mockLocation, tt.mockLocErr
 			}
 
-			fetchWeatherFn = func(location, apiKey string) (*WeatherData, error) {
+			fetchWeatherFn = func(ctx context.Context, limiter *quota.Limiter, location, apiKey string) (*WeatherData, error) {
 				return tt.mockWeather, tt.mockWeatherErr
 			}
 
-			uc := NewServicoBUseCase(tt.apiKey)
-			got, err := uc.Execute(tt.zipcode)
+			uc := NewServicoBUseCase(keypool.New("weatherapi", []string{tt.apiKey}, 0), nil)
+			got, err := uc.Execute(context.Background(), tt.zipcode)
 
 			if (err != nil) != tt.expectError {
 				t.Errorf("Execute() error = %v, expectError %v", err, tt.expectError)
@@ -402,7 +441,231 @@ func TestServicoBUseCase_Execute(t *testing.T) {
 	}
 }
 
+func TestServicoBUseCase_Execute_CallerDeadline(t *testing.T) {
+	originalFetchLocation := fetchLocationFn
+	originalFetchWeather := fetchWeatherFn
+	defer func() {
+		fetchLocationFn = originalFetchLocation
+		fetchWeatherFn = originalFetchWeather
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	weatherCalled := false
+	fetchLocationFn = func(ctx context.Context, zipcode string) (string, error) {
+		<-ctx.Done()
+		return "São Paulo", nil
+	}
+	fetchWeatherFn = func(ctx context.Context, limiter *quota.Limiter, location, apiKey string) (*WeatherData, error) {
+		weatherCalled = true
+		return &WeatherData{}, nil
+	}
+
+	_, err := NewServicoBUseCase(keypool.New("weatherapi", []string{"valid-key"}, 0), nil).Execute(ctx, "12345678")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Execute() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if weatherCalled {
+		t.Error("expected weather fetch to be skipped once the caller deadline expired")
+	}
+}
+
+func TestServicoBUseCase_Execute_UFOnSpan(t *testing.T) {
+	originalFetchLocation := fetchLocationFn
+	defer func() { fetchLocationFn = originalFetchLocation }()
+	fetchLocationFn = func(ctx context.Context, zipcode string) (string, error) {
+		return "", fmt.Errorf("can not find zipcode")
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	ctx, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "test")
+	_, err := NewServicoBUseCase(nil, nil).Execute(ctx, "01001000")
+	span.End()
+	if err == nil {
+		t.Fatal("Execute() error = nil, want the location error")
+	}
+
+	for _, kv := range recorder.Ended()[0].Attributes() {
+		if kv.Key == cep.UFKey && kv.Value.AsString() == "SP" {
+			return
+		}
+	}
+	t.Errorf("span attributes = %v, want %s=SP on a failed lookup", recorder.Ended()[0].Attributes(), cep.UFKey)
+}
+
 // Helper function to check if a string contains another string
 func containsString(s, substr string) bool {
 	return len(s) >= len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || (len(s) > len(substr) && s[1:len(s)-1] == substr))
 }
+
+func TestPingDependencies(t *testing.T) {
+	originalDo := httpClientDo
+	defer func() { httpClientDo = originalDo }()
+
+	tests := []struct {
+		name        string
+		status      int
+		err         error
+		expectError bool
+	}{
+		{name: "should pass when the API answers", status: http.StatusOK},
+		{name: "should pass when the API rejects the request", status: http.StatusUnauthorized},
+		{name: "should fail on a server error", status: http.StatusBadGateway, expectError: true},
+		{name: "should fail when unreachable", err: fmt.Errorf("connection refused"), expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var urls []string
+			httpClientDo = func(req *http.Request) (*http.Response, error) {
+				urls = append(urls, req.URL.String())
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status), Body: io.NopCloser(strings.NewReader(""))}, nil
+			}
+
+			for _, ping := range []func(context.Context) error{PingViaCEP, PingWeatherAPI} {
+				if err := ping(context.Background()); (err != nil) != tt.expectError {
+					t.Errorf("ping error = %v, expectError %v", err, tt.expectError)
+				}
+			}
+			for _, u := range urls {
+				if strings.Contains(u, "key=") {
+					t.Errorf("ping sent an API key: %s", u)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchWeather_Quota(t *testing.T) {
+	originalDo := httpClientDo
+	defer func() { httpClientDo = originalDo }()
+
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		header       http.Header
+		wantReason   string
+		wantNextCall string
+	}{
+		{
+			name:         "should honor an upstream 429",
+			status:       http.StatusTooManyRequests,
+			header:       http.Header{"Retry-After": {"60"}},
+			wantReason:   quota.ReasonUpstream,
+			wantNextCall: quota.ReasonUpstream,
+		},
+		{
+			name:         "should stop calling once WeatherAPI reports the monthly quota over",
+			status:       http.StatusForbidden,
+			body:         `{"error": {"code": 2007, "message": "API key has exceeded calls per month quota."}}`,
+			wantReason:   quota.ReasonBudget,
+			wantNextCall: quota.ReasonBudget,
+		},
+		{
+			name:   "should keep calling after other errors",
+			status: http.StatusBadRequest,
+			body:   `{"error": {"code": 1006, "message": "No matching location found."}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := NewWeatherAPIQuota(configs.WeatherAPI{})
+			if err != nil {
+				t.Fatalf("NewWeatherAPIQuota() error = %v", err)
+			}
+			calls := 0
+			httpClientDo = func(req *http.Request) (*http.Response, error) {
+				calls++
+				return &http.Response{StatusCode: tt.status, Header: tt.header, Body: io.NopCloser(strings.NewReader(tt.body))}, nil
+			}
+
+			uc := NewServicoBUseCase(keypool.New("weatherapi", []string{"key"}, 0), limiter)
+			_, err = uc.fetchWeather(context.Background(), "São Paulo")
+			if err == nil || exhaustedReason(err) != tt.wantReason {
+				t.Errorf("fetchWeather() error = %v, want reason %q", err, tt.wantReason)
+			}
+			_, err = uc.fetchWeather(context.Background(), "São Paulo")
+			if exhaustedReason(err) != tt.wantNextCall {
+				t.Errorf("second fetchWeather() error = %v, want reason %q", err, tt.wantNextCall)
+			}
+			wantCalls := 2
+			if tt.wantNextCall != "" {
+				wantCalls = 1
+			}
+			if calls != wantCalls {
+				t.Errorf("WeatherAPI called %d times, want %d", calls, wantCalls)
+			}
+		})
+	}
+}
+
+func TestFetchWeather_KeyRotation(t *testing.T) {
+	originalDo := httpClientDo
+	defer func() { httpClientDo = originalDo }()
+
+	tests := []struct {
+		name       string
+		keys       []string
+		answers    map[string]int
+		wantKeys   []string
+		wantReason string
+	}{
+		{
+			name:     "should stay on a working key",
+			keys:     []string{"good", "spare"},
+			answers:  map[string]int{"good": http.StatusOK},
+			wantKeys: []string{"good", "good"},
+		},
+		{
+			name:     "should rotate past an unauthorized key",
+			keys:     []string{"revoked", "good"},
+			answers:  map[string]int{"revoked": http.StatusUnauthorized, "good": http.StatusOK},
+			wantKeys: []string{"revoked", "good", "good"},
+		},
+		{
+			name:       "should give up once every key is rejected",
+			keys:       []string{"revoked", "disabled"},
+			answers:    map[string]int{"revoked": http.StatusUnauthorized, "disabled": http.StatusForbidden},
+			wantKeys:   []string{"revoked", "disabled"},
+			wantReason: quota.ReasonKeys,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var used []string
+			httpClientDo = func(req *http.Request) (*http.Response, error) {
+				key := req.URL.Query().Get("key")
+				used = append(used, key)
+				status := tt.answers[key]
+				return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(`{"current": {"temp_c": 20}}`))}, nil
+			}
+
+			uc := NewServicoBUseCase(keypool.New("weatherapi", tt.keys, 0), nil)
+			var err error
+			for i := 0; i < 2 && err == nil; i++ {
+				_, err = uc.fetchWeather(context.Background(), "São Paulo")
+			}
+			if exhaustedReason(err) != tt.wantReason {
+				t.Errorf("fetchWeather() error = %v, want reason %q", err, tt.wantReason)
+			}
+			if !reflect.DeepEqual(used, tt.wantKeys) {
+				t.Errorf("keys used = %v, want %v", used, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func exhaustedReason(err error) string {
+	var exhausted *quota.ExhaustedError
+	if errors.As(err, &exhausted) {
+		return exhausted.Reason
+	}
+	return ""
+}